@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"github.com/minhnghia2k3/greenlight/internal/data"
+	"github.com/pascaldekloe/jwt"
 	"net/http"
 )
 
@@ -12,6 +13,9 @@ type contextKey string
 // Convert the string "user" to a contextKey type and assign it to the userContextKey
 const userContextKey = contextKey("user")
 
+// claimsContextKey holds the claims of the JWT a request was authenticated with
+const claimsContextKey = contextKey("claims")
+
 // The contextSetUser method returns a new copy of the request with the provided
 // User struct added to the context. Note that we use our userContextKey constant as the key.
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
@@ -28,3 +32,21 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 
 	return user
 }
+
+// The contextSetClaims method returns a new copy of the request with the claims of its
+// access token added to the context.
+func (app *application) contextSetClaims(r *http.Request, claims *jwt.Claims) *http.Request {
+	ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+	return r.WithContext(ctx)
+}
+
+// The contextGetClaims() retrieves the claims of the access token from the request
+// context. It's only set for authenticated users.
+func (app *application) contextGetClaims(r *http.Request) *jwt.Claims {
+	claims, ok := r.Context().Value(claimsContextKey).(*jwt.Claims)
+	if !ok {
+		panic("missing claims value in request context")
+	}
+
+	return claims
+}
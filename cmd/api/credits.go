@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"github.com/minhnghia2k3/greenlight/internal/data"
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"net/http"
+)
+
+type CreditInput struct {
+	PersonID     int64  `json:"person_id" example:"1"`
+	Role         string `json:"role" example:"actor"`
+	Character    string `json:"character" example:"T'Challa"`
+	BillingOrder int32  `json:"billing_order" example:"1"`
+}
+
+type CreditResponse struct {
+	Credit data.Credit `json:"credit"`
+}
+
+// @Summary      Credit a person on a movie
+// @Description  add a director, actor or writer credit to an existing movie
+// @Param id path int true "movie id"
+// @Param input body CreditInput true "create credit payload"
+// @Param If-Match header string false "ETag of the movie version being changed"
+// @Tags         Movies
+// @Accept 		 json
+// @Produce      json
+// @Security Bearer
+// @Success      201  {object} CreditResponse
+// @Failure      400  {object} Error
+// @Failure      404  {object} Error
+// @Failure      412  {object} Error
+// @Failure      422  {object} Error
+// @Failure      428  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/{id}/credits [post]
+func (app *application) createMovieCreditHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.checkIfMatch(w, r, versionETag(movie.Version)) {
+		return
+	}
+
+	var input CreditInput
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err.Error())
+		return
+	}
+
+	credit := &data.Credit{
+		MovieID:      movie.ID,
+		PersonID:     input.PersonID,
+		Role:         input.Role,
+		Character:    input.Character,
+		BillingOrder: input.BillingOrder,
+	}
+
+	v := validation.New()
+
+	if data.ValidateCredit(v, credit); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The credited person must exist, the name is echoed back in the response
+	person, err := app.models.People.Get(credit.PersonID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("person_id", "no matching person found")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	credit.Name = person.Name
+
+	err = app.models.Credits.Insert(credit)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateCredit):
+			v.AddError("role", "this person is already credited in this role")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelop{"credit": credit}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Remove a credit from a movie
+// @Description  remove the credits of a person on a movie, optionally only for a single role
+// @Param id path int true "movie id"
+// @Param person_id path int true "person id"
+// @Param role query string false "role"
+// @Param If-Match header string false "ETag of the movie version being changed"
+// @Tags         Movies
+// @Accept 		 json
+// @Produce      json
+// @Security Bearer
+// @Success      200  {object} MessageResponse
+// @Failure      404  {object} Error
+// @Failure      412  {object} Error
+// @Failure      428  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/{id}/credits/{person_id} [delete]
+func (app *application) deleteMovieCreditHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	personID, err := app.readInt64Param(r, "person_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	role := app.readString(r.URL.Query(), "role", "")
+
+	if !app.checkMovieIfMatch(w, r, id) {
+		return
+	}
+
+	err = app.models.Credits.Delete(id, personID, role)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"message": "credit successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/minhnghia2k3/greenlight/internal/data"
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// exportWriteTimeout replaces the server write timeout while an export is streamed.
+	exportWriteTimeout = 30 * time.Minute
+
+	// exportFlushRows is how many rows are buffered before they are sent to the client.
+	exportFlushRows = 500
+)
+
+// sentWriter records whether anything was written through it, so that an export knows
+// whether part of it already reached the client.
+type sentWriter struct {
+	w    io.Writer
+	sent bool
+}
+
+func (sw *sentWriter) Write(p []byte) (int, error) {
+	sw.sent = true
+	return sw.w.Write(p)
+}
+
+// @Summary      Export movies
+// @Description  stream every movie matching the title and genres filters, ordered by id, as NDJSON (one movie per line) or CSV. Unlike the listing it isn't paginated.
+// @Param format query string false "ndjson (default) or csv"
+// @Param title query string false "title"
+// @Param genres query string false "genres"
+// @Security Bearer
+// @Tags         Movies
+// @Accept 		 json
+// @Produce      application/x-ndjson
+// @Produce      text/csv
+// @Success      200
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/export [get]
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Format string
+		Title  string
+		Genres []string
+	}
+
+	v := validation.New()
+	qs := r.URL.Query()
+
+	input.Format = app.readString(qs, "format", "ndjson")
+	input.Title = app.readString(qs, "title", "")
+	input.Genres = app.readCSV(qs, "genres", []string{})
+
+	if v.Check(validation.PermittedValue(input.Format, "ndjson", "csv"), "format", "must be ndjson or csv"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Genre filters may use any spelling of a genre, like on the listing
+	genres, err := app.models.Genres.Vocabulary()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	input.Genres = genres.Canonical(input.Genres)
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+
+	// The buffer is also written out when it fills up, not only every exportFlushRows rows
+	sw := &sentWriter{w: w}
+	bw := bufio.NewWriter(sw)
+
+	var writeRow func(*data.Movie) error
+	switch input.Format {
+	case "csv":
+		cw := csv.NewWriter(bw)
+		writeRow = func(movie *data.Movie) error {
+			cw.Write([]string{
+				strconv.FormatInt(movie.ID, 10),
+				movie.CreatedAt.Format(time.RFC3339),
+				movie.Title,
+				strconv.FormatInt(int64(movie.Year), 10),
+				strconv.FormatInt(int64(movie.Runtime), 10),
+				strings.Join(movie.Genres, ","),
+				strconv.FormatInt(int64(movie.Version), 10),
+				strconv.FormatFloat(movie.AverageRating, 'f', 2, 64),
+				strconv.FormatInt(int64(movie.RatingCount), 10),
+			})
+			cw.Flush()
+			return cw.Error()
+		}
+	default:
+		enc := json.NewEncoder(bw)
+		writeRow = func(movie *data.Movie) error {
+			return enc.Encode(movie)
+		}
+	}
+
+	// The status and headers are only sent with the first row, so that a failing query
+	// can still be reported as an error response.
+	rows := 0
+	start := func() error {
+		switch input.Format {
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="movies.csv"`)
+			_, err := bw.WriteString("id,created_at,title,year,runtime,genres,version,average_rating,rating_count\n")
+			return err
+		default:
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("Content-Disposition", `attachment; filename="movies.ndjson"`)
+			return nil
+		}
+	}
+
+	err = app.models.Movies.Export(r.Context(), input.Title, input.Genres, func(movie *data.Movie) error {
+		if rows == 0 {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+
+		if err := writeRow(movie); err != nil {
+			return err
+		}
+
+		rows++
+		if rows%exportFlushRows == 0 {
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+			return rc.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// Nothing was sent yet, so the buffered rows are dropped for an error response
+		if !sw.sent {
+			w.Header().Del("Content-Disposition")
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// Part of the export has been sent, so the status can't be changed any more. Abort
+		// the response instead, so the client sees a reset connection and not an export
+		// which looks complete.
+		app.logError(r, err)
+		panic(http.ErrAbortHandler)
+	}
+
+	if rows == 0 {
+		err = start()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = bw.Flush()
+	if err != nil {
+		app.logError(r, err)
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/minhnghia2k3/greenlight/internal/data"
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"net/http"
+)
+
+type GenreInput struct {
+	Slug    *string  `json:"slug" example:"sci-fi"`
+	Name    *string  `json:"name" example:"Science Fiction"`
+	Aliases []string `json:"aliases" example:"science fiction,scifi"`
+}
+
+type ListGenres struct {
+	Data data.Genre `json:"data"`
+}
+
+type GenreResponse struct {
+	Genre data.Genre `json:"genre"`
+}
+
+// readSlugParam returns the slug path parameter of a genre route.
+func (app *application) readSlugParam(r *http.Request) string {
+	return httprouter.ParamsFromContext(r.Context()).ByName("slug")
+}
+
+// @Summary      Create genre
+// @Description  add a genre to the vocabulary movies pick their genres from. The aliases are other spellings which are resolved to the slug.
+// @Param input body GenreInput true "create genre payload"
+// @Tags         Genres
+// @Accept 		 json
+// @Produce      json
+// @Security Bearer
+// @Success      201  {object} GenreResponse
+// @Failure      400  {object} Error
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /genres [post]
+func (app *application) createGenreHandler(w http.ResponseWriter, r *http.Request) {
+	var input GenreInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err.Error())
+		return
+	}
+
+	genre := &data.Genre{Aliases: []string{}}
+
+	if input.Slug != nil {
+		genre.Slug = *input.Slug
+	}
+
+	if input.Name != nil {
+		genre.Name = *input.Name
+	}
+
+	if input.Aliases != nil {
+		genre.Aliases = input.Aliases
+	}
+
+	v := validation.New()
+
+	if data.ValidateGenre(v, genre); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Genres.Insert(genre)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateGenre):
+			v.AddError("slug", "the slug or one of the aliases already names a genre")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/genres/%s", genre.Slug))
+
+	err = app.writeJSON(w, http.StatusCreated, envelop{"genre": genre}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      List genres
+// @Description  show every genre of the vocabulary with its aliases, ordered by slug
+// @Security Bearer
+// @Tags         Genres
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} ListGenres
+// @Failure      500  {object} Error
+// @Router       /genres [get]
+func (app *application) listGenresHandler(w http.ResponseWriter, r *http.Request) {
+	genres, err := app.models.Genres.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"genres": genres}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Get genre by slug
+// @Description  get a genre of the vocabulary with its aliases
+// @Param slug path string true "slug"
+// @Security Bearer
+// @Tags         Genres
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} GenreResponse
+// @Failure      404  {object} Error
+// @Failure      500  {object} Error
+// @Router       /genres/{slug} [get]
+func (app *application) showGenreHandler(w http.ResponseWriter, r *http.Request) {
+	genre, err := app.models.Genres.Get(app.readSlugParam(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"genre": genre}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Update genre
+// @Description  change the name or replace the aliases of a genre. The slug can't be changed.
+// @Param slug path string true "slug"
+// @Param input body GenreInput true "update genre payload"
+// @Security Bearer
+// @Tags         Genres
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} GenreResponse
+// @Failure      400  {object} Error
+// @Failure      404  {object} Error
+// @Failure      409  {object} Error
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /genres/{slug} [patch]
+func (app *application) updateGenreHandler(w http.ResponseWriter, r *http.Request) {
+	genre, err := app.models.Genres.Get(app.readSlugParam(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input GenreInput
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err.Error())
+		return
+	}
+
+	v := validation.New()
+
+	v.Check(input.Slug == nil || *input.Slug == genre.Slug, "slug", "must not be changed")
+
+	if input.Name != nil {
+		genre.Name = *input.Name
+	}
+
+	if input.Aliases != nil {
+		genre.Aliases = input.Aliases
+	}
+
+	if data.ValidateGenre(v, genre); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Genres.Update(genre)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateGenre):
+			v.AddError("aliases", "one of the aliases already names another genre")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrConflictEdit):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"genre": genre}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Delete genre
+// @Description  delete a genre and its aliases. Genres still used by a movie, including trashed movies, can't be deleted.
+// @Param slug path string true "slug"
+// @Security Bearer
+// @Tags         Genres
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} MessageResponse
+// @Failure      404  {object} Error
+// @Failure      409  {object} Error
+// @Failure      500  {object} Error
+// @Router       /genres/{slug} [delete]
+func (app *application) deleteGenreHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.models.Genres.Delete(app.readSlugParam(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrGenreInUse):
+			app.errorResponse(w, r, http.StatusConflict, "the genre is still used by movies")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"message": "genre successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,25 +1,35 @@
 package main
 
 import (
+	"cmp"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/julienschmidt/httprouter"
+	"github.com/minhnghia2k3/greenlight/internal/data"
 	"github.com/minhnghia2k3/greenlight/internal/validation"
 	"io"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // readIdParam convert id parameter into int based 10 with 64 bits.
 // returns an id and correspond error
 func (app *application) readIdParam(r *http.Request) (int64, error) {
+	return app.readInt64Param(r, "id")
+}
+
+// readInt64Param convert the named path parameter into int based 10 with 64 bits.
+// returns the value and correspond error
+func (app *application) readInt64Param(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 
 	return id, nil
@@ -27,6 +37,10 @@ func (app *application) readIdParam(r *http.Request) (int64, error) {
 
 type envelop map[string]any
 
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
 /*
 writeJSON helper for sending responses. This takes the destination http.ResponseWriter, the HTTP status code to send,
 the data to encode to JSON, and a header map.
@@ -184,6 +198,232 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+// The readBool helper reads a string value from the query string and converts it to a
+// boolean before returning. If no matching key could be found it returns the provided
+// default value. If the value couldn't be converted to a boolean, then we record
+// an error message in the provided Validator instance
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validation.Validator) bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
+
+// The readTime helper reads a string value from the query string and parses it as an
+// RFC 3339 timestamp, or as a date at midnight UTC, before returning. If no matching key
+// could be found it returns the zero time. If the value couldn't be parsed, then we record
+// an error message in the provided Validator instance
+func (app *application) readTime(qs url.Values, key string, v *validation.Validator) time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t, err = time.Parse(time.DateOnly, s)
+		if err != nil {
+			v.AddError(key, "must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+			return time.Time{}
+		}
+	}
+
+	return t
+}
+
+// maxLanguages caps how many preferred languages are read from a request.
+const maxLanguages = 10
+
+// The readLanguages helper returns the languages a client prefers, best first: the lang
+// query parameter, then the tags of the Accept-Language header ordered by quality. Each
+// regional tag, like pt-BR, is followed by its base language, so that a title in pt is
+// used when there is none in pt-BR. Malformed header tags are skipped, an invalid lang
+// parameter is recorded in the provided Validator instance
+func (app *application) readLanguages(r *http.Request, v *validation.Validator) []string {
+	type tag struct {
+		name    string
+		quality float64
+	}
+
+	var tags []tag
+
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		lang = data.NormalizeLocale(lang)
+		if data.ValidateLocale(v, "lang", lang); v.Valid() {
+			tags = append(tags, tag{lang, 2})
+		}
+	}
+
+	// Accept-Language: fr-CH, fr;q=0.9, en;q=0.8, *;q=0.5
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = data.NormalizeLocale(name)
+		if !validation.Matches(name, data.LocaleRX) {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil || parsed <= 0 || parsed > 1 {
+				continue
+			}
+			quality = parsed
+		}
+
+		tags = append(tags, tag{name, quality})
+	}
+
+	slices.SortStableFunc(tags, func(a, b tag) int {
+		return cmp.Compare(b.quality, a.quality)
+	})
+
+	var languages []string
+	for _, t := range tags {
+		for _, name := range []string{t.name, strings.Split(t.name, "-")[0]} {
+			if !slices.Contains(languages, name) && len(languages) < maxLanguages {
+				languages = append(languages, name)
+			}
+		}
+	}
+
+	return languages
+}
+
+// versionETag returns the entity tag of a record at a version. Movie versions are bumped by
+// every write changing their representation, like a new rating, image, credit or title, not
+// only by edits.
+func versionETag(version int32) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// localizedETag returns the entity tag of a movie at a version with its title localized
+// to the preferred languages, e.g. "5-fr+en", so that each language variant has its own
+// tag. Without languages it's the version entity tag.
+func localizedETag(version int32, languages []string) string {
+	if len(languages) == 0 {
+		return versionETag(version)
+	}
+
+	return fmt.Sprintf(`"%d-%s"`, version, strings.Join(languages, "+"))
+}
+
+// etagVersion strips the languages from the entity tag of a localized variant, leaving
+// the version entity tag.
+func etagVersion(etag string) string {
+	if version, _, found := strings.Cut(etag, "-"); found && strings.HasPrefix(etag, `"`) {
+		return version + `"`
+	}
+
+	return etag
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header lists the entity tag.
+// Weak comparison, used for If-None-Match, ignores the W/ prefix of the listed tags.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkIfMatch makes a write conditional on the If-Match header of the request, so that a
+// client can't overwrite changes it hasn't seen. Any language variant of the entity tag
+// matches, as the variants are of the same version. Requests without the header are
+// allowed unless If-Match is required. When it returns false an error response has
+// already been sent.
+func (app *application) checkIfMatch(w http.ResponseWriter, r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+
+	if header == "" {
+		if app.config.conditional.requireIfMatch {
+			app.preconditionRequiredResponse(w, r)
+			return false
+		}
+		return true
+	}
+
+	var tags []string
+	for _, candidate := range strings.Split(header, ",") {
+		tags = append(tags, etagVersion(strings.TrimSpace(candidate)))
+	}
+
+	if !etagMatches(strings.Join(tags, ","), etag, false) {
+		app.preconditionFailedResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// checkMovieIfMatch is checkIfMatch for the writes which change a movie through its
+// related records, like its reviews, titles, credits and images, and bump its version.
+// The movie is only looked up when there's an If-Match header to check or one is
+// required.
+func (app *application) checkMovieIfMatch(w http.ResponseWriter, r *http.Request, id int64) bool {
+	if r.Header.Get("If-Match") == "" && !app.config.conditional.requireIfMatch {
+		return true
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+
+	return app.checkIfMatch(w, r, versionETag(movie.Version))
+}
+
+// project trims the JSON object of a record to the fields and expansions of a projection.
+// The record is returned unchanged when no fields were asked for.
+func project(record any, p data.Projection) (any, error) {
+	if len(p.Fields) == 0 {
+		return record, nil
+	}
+
+	js, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(js, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	for key := range fields {
+		if !p.Includes(key) && !p.Expands(key) {
+			delete(fields, key)
+		}
+	}
+
+	return fields, nil
+}
+
 // The background() helper accepts an any function as a parameter
 func (app *application) background(fn func()) {
 	app.wg.Add(1)
@@ -2,8 +2,10 @@ package main
 
 import (
 	"github.com/minhnghia2k3/greenlight/internal/data"
+	"github.com/minhnghia2k3/greenlight/internal/validation"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"testing"
 	"time"
 )
@@ -31,6 +33,73 @@ func BenchmarkWriteJSON(b *testing.B) {
 	}
 }
 
+func TestReadLanguages(t *testing.T) {
+	tests := []struct {
+		url            string
+		acceptLanguage string
+		want           []string
+	}{
+		{"/v1/movies", "", nil},
+		{"/v1/movies", "fr-CH, fr;q=0.9, en;q=0.8, *;q=0.5", []string{"fr-ch", "fr", "en"}},
+		{"/v1/movies", "en;q=0.5, pt-BR", []string{"pt-br", "pt", "en"}},
+		{"/v1/movies", "de;q=0, es;q=abc, it", []string{"it"}},
+		{"/v1/movies?lang=ja", "en", []string{"ja", "en"}},
+		{"/v1/movies?lang=zh_TW", "", []string{"zh-tw", "zh"}},
+	}
+
+	app := &application{}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		r.Header.Set("Accept-Language", tt.acceptLanguage)
+
+		v := validation.New()
+		got := app.readLanguages(r, v)
+		if !v.Valid() || !slices.Equal(got, tt.want) {
+			t.Errorf("%s %q: got %v (%v), want %v", tt.url, tt.acceptLanguage, got, v.Errors, tt.want)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/movies?lang=not+a+language", nil)
+	v := validation.New()
+	app.readLanguages(r, v)
+	if v.Valid() {
+		t.Error("expected an invalid lang parameter to be reported")
+	}
+}
+
+func TestLocalizedETag(t *testing.T) {
+	tests := []struct {
+		ifMatch string
+		want    bool
+	}{
+		{`"5"`, true},
+		{`"5-fr+en"`, true},
+		{`"4-fr", "5-pt-br"`, true},
+		{`"4-fr"`, false},
+		{`"50"`, false},
+	}
+
+	if got := localizedETag(5, nil); got != `"5"` {
+		t.Errorf("without languages: got %s", got)
+	}
+	if got := localizedETag(5, []string{"fr", "en"}); got != `"5-fr+en"` {
+		t.Errorf("with languages: got %s", got)
+	}
+
+	app := &application{}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPatch, "/v1/movies/1", nil)
+		r.Header.Set("If-Match", tt.ifMatch)
+
+		if got := app.checkIfMatch(rr, r, versionETag(5)); got != tt.want {
+			t.Errorf("If-Match %s: got %t, want %t", tt.ifMatch, got, tt.want)
+		}
+	}
+}
+
 //func BenchmarkWriteJSONIndent(b *testing.B) {
 //	app := &application{}
 //	movie := data.Movie{
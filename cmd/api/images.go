@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/minhnghia2k3/greenlight/internal/data"
+	"github.com/minhnghia2k3/greenlight/internal/imaging"
+	"github.com/minhnghia2k3/greenlight/internal/storage"
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// imageWidths lists the thumbnail widths generated for each kind of movie image.
+var imageWidths = map[string][]int{
+	data.ImagePoster:   {185, 342, 780},
+	data.ImageBackdrop: {300, 780, 1280},
+}
+
+// imageKey returns the storage key of a file of an uploaded movie image.
+func imageKey(movieID int64, kind, image, file string) string {
+	return fmt.Sprintf("movies/%d/%s/%s/%s", movieID, kind, image, file)
+}
+
+// thumbnailFile returns the name a thumbnail of the given width is stored under.
+func thumbnailFile(width int) string {
+	return fmt.Sprintf("w%d.jpg", width)
+}
+
+// @Summary      Upload movie poster
+// @Description  upload a JPEG, PNG or GIF poster, either as the raw request body or as the image field of a multipart form. Thumbnails 185, 342 and 780 pixels wide are generated, and the poster replaces any previous one.
+// @Param id path int true "movie id"
+// @Param image formData file false "poster image, for multipart uploads"
+// @Param If-Match header string false "ETag of the movie version being changed"
+// @Security Bearer
+// @Tags         Movies
+// @Accept 		 multipart/form-data
+// @Accept 		 image/jpeg
+// @Accept 		 image/png
+// @Accept 		 image/gif
+// @Produce      json
+// @Success      200  {object} MovieResponse
+// @Failure      400  {object} Error
+// @Failure      404  {object} Error
+// @Failure      412  {object} Error
+// @Failure      422  {object} Error
+// @Failure      428  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/{id}/poster [put]
+func (app *application) uploadMoviePosterHandler(w http.ResponseWriter, r *http.Request) {
+	app.uploadMovieImage(w, r, data.ImagePoster)
+}
+
+// @Summary      Upload movie backdrop
+// @Description  upload a JPEG, PNG or GIF backdrop, either as the raw request body or as the image field of a multipart form. Thumbnails 300, 780 and 1280 pixels wide are generated, and the backdrop replaces any previous one.
+// @Param id path int true "movie id"
+// @Param image formData file false "backdrop image, for multipart uploads"
+// @Param If-Match header string false "ETag of the movie version being changed"
+// @Security Bearer
+// @Tags         Movies
+// @Accept 		 multipart/form-data
+// @Accept 		 image/jpeg
+// @Accept 		 image/png
+// @Accept 		 image/gif
+// @Produce      json
+// @Success      200  {object} MovieResponse
+// @Failure      400  {object} Error
+// @Failure      404  {object} Error
+// @Failure      412  {object} Error
+// @Failure      422  {object} Error
+// @Failure      428  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/{id}/backdrop [put]
+func (app *application) uploadMovieBackdropHandler(w http.ResponseWriter, r *http.Request) {
+	app.uploadMovieImage(w, r, data.ImageBackdrop)
+}
+
+// @Summary      Show movie poster
+// @Description  serve the poster of a movie, or one of its thumbnails when w is given. Range and conditional requests are supported. Requests with the v parameter of the movie's poster_url can be cached indefinitely.
+// @Param id path int true "movie id"
+// @Param w query int false "thumbnail width: 185, 342 or 780"
+// @Param v query string false "image version, from poster_url"
+// @Tags         Movies
+// @Produce      image/jpeg
+// @Produce      image/png
+// @Produce      image/gif
+// @Success      200
+// @Success      206
+// @Success      304
+// @Failure      404  {object} Error
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/{id}/poster [get]
+func (app *application) showMoviePosterHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveMovieImage(w, r, data.ImagePoster)
+}
+
+// @Summary      Show movie backdrop
+// @Description  serve the backdrop of a movie, or one of its thumbnails when w is given. Range and conditional requests are supported. Requests with the v parameter of the movie's backdrop_url can be cached indefinitely.
+// @Param id path int true "movie id"
+// @Param w query int false "thumbnail width: 300, 780 or 1280"
+// @Param v query string false "image version, from backdrop_url"
+// @Tags         Movies
+// @Produce      image/jpeg
+// @Produce      image/png
+// @Produce      image/gif
+// @Success      200
+// @Success      206
+// @Success      304
+// @Failure      404  {object} Error
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/{id}/backdrop [get]
+func (app *application) showMovieBackdropHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveMovieImage(w, r, data.ImageBackdrop)
+}
+
+// uploadMovieImage validates an uploaded image, stores it with its thumbnails and makes
+// it the movie's image of the given kind.
+func (app *application) uploadMovieImage(w http.ResponseWriter, r *http.Request, kind string) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Make sure the movie exists before the upload is processed
+	_, err = app.models.Movies.GetImage(id, kind)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.checkMovieIfMatch(w, r, id) {
+		return
+	}
+
+	body, err := app.readImage(w, r)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.badRequestResponse(w, r, fmt.Sprintf("image must not be larger than %d bytes", app.config.images.maxBytes))
+		default:
+			app.badRequestResponse(w, r, err.Error())
+		}
+		return
+	}
+
+	v := validation.New()
+
+	img, _, err := imaging.Decode(body)
+	if err != nil {
+		switch {
+		case errors.Is(err, imaging.ErrUnsupportedType):
+			v.AddError("image", "must be a JPEG, PNG or GIF image")
+		case errors.Is(err, imaging.ErrTooLarge):
+			v.AddError("image", fmt.Sprintf("must not have more than %d pixels", imaging.MaxPixels))
+		default:
+			v.AddError("image", "must be a valid image")
+		}
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Images are stored under a hash of their content, so a replaced image never shares
+	// its URL with the new one.
+	sum := sha256.Sum256(body)
+	image := hex.EncodeToString(sum[:16])
+
+	err = app.storage.Put(imageKey(id, kind, image, "original"), bytes.NewReader(body))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, width := range imageWidths[kind] {
+		var buf bytes.Buffer
+
+		err = imaging.EncodeJPEG(&buf, imaging.Thumbnail(img, width))
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.storage.Put(imageKey(id, kind, image, thumbnailFile(width)), &buf)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	previous, err := app.models.Movies.SetImage(id, kind, image)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if previous != "" && previous != image {
+		err = app.storage.DeleteAll(fmt.Sprintf("movies/%d/%s/%s", id, kind, previous))
+		if err != nil {
+			app.logError(r, err)
+		}
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readImage reads an uploaded image from the image field of a multipart form, or from
+// the raw request body.
+func (app *application) readImage(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, app.config.images.maxBytes)
+
+	var body io.Reader = r.Body
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			part, err := mr.NextPart()
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("multipart body must contain an image field")
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			if part.FormName() == "image" {
+				body = part
+				break
+			}
+		}
+	}
+
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) == 0 {
+		return nil, errors.New("image must not be empty")
+	}
+
+	return b, nil
+}
+
+// serveMovieImage serves a movie image of the given kind, or one of its thumbnails.
+func (app *application) serveMovieImage(w http.ResponseWriter, r *http.Request, kind string) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validation.New()
+	qs := r.URL.Query()
+
+	width := app.readInt(qs, "w", 0, v)
+	if v.Check(width == 0 || slices.Contains(imageWidths[kind], width), "w", fmt.Sprintf("must be one of %v", imageWidths[kind])); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	image, err := app.models.Movies.GetImage(id, kind)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if image == "" {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	file := "original"
+	if width != 0 {
+		file = thumbnailFile(width)
+	}
+
+	object, err := app.storage.Open(imageKey(id, kind, image, file))
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer object.Close()
+
+	// A request naming the current version gets a response which never changes. Without
+	// it, clients have to revalidate, since the movie's image may be replaced.
+	if qs.Get("v") == image {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "public, no-cache")
+	}
+	w.Header().Set("ETag", strconv.Quote(image+"-"+file))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// ServeContent answers Range, If-Range, If-None-Match and If-Modified-Since requests,
+	// and sniffs the content type.
+	http.ServeContent(w, r, file, object.ModTime(), object)
+}
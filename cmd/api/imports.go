@@ -0,0 +1,593 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/minhnghia2k3/greenlight/internal/data"
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// importReadTimeout replaces the server read timeout while an import is uploaded.
+	importReadTimeout = 30 * time.Minute
+
+	// importBatchSize is how many rows are inserted, and how often progress is saved.
+	importBatchSize = 500
+
+	// maxImportRowErrors caps the row errors stored per import. Further failed rows are
+	// still counted.
+	maxImportRowErrors = 10_000
+
+	// maxImportLineBytes caps the length of a single NDJSON row.
+	maxImportLineBytes = 1_048_576
+)
+
+type MovieImportResponse struct {
+	Import data.MovieImport `json:"import"`
+}
+
+type MovieImportReport struct {
+	Import   data.MovieImport      `json:"import"`
+	Errors   []data.ImportRowError `json:"errors"`
+	Metadata data.Metadata         `json:"metadata"`
+}
+
+// @Summary      Import movies
+// @Description  upload movies in bulk as NDJSON (one object per line), a JSON array or CSV with a title,year,runtime,genres header. The format is taken from the format query parameter or the Content-Type. Rows are validated and inserted in the background, poll the returned import for progress.
+// @Param format query string false "json, ndjson or csv"
+// @Security Bearer
+// @Tags         Movies
+// @Accept 		 json
+// @Accept 		 application/x-ndjson
+// @Accept 		 text/csv
+// @Produce      json
+// @Success      202  {object} MovieImportResponse
+// @Failure      400  {object} Error
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/imports [post]
+func (app *application) createMovieImportHandler(w http.ResponseWriter, r *http.Request) {
+	v := validation.New()
+
+	format := importFormat(r)
+	if v.Check(validation.PermittedValue(format, "json", "ndjson", "csv"), "format", "must be json, ndjson or csv"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Large catalogues take longer to upload than the server timeouts allow, so extend them
+	// for this request only.
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Now().Add(importReadTimeout))
+	_ = rc.SetWriteDeadline(time.Now().Add(importReadTimeout + 30*time.Second))
+
+	r.Body = http.MaxBytesReader(w, r.Body, app.config.imports.maxBytes)
+
+	// The upload is buffered to disk, so that the request can return while the rows are
+	// processed in the background.
+	file, err := os.CreateTemp(app.config.imports.dir, "movie-import-*")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	discard := func() {
+		file.Close()
+		os.Remove(file.Name())
+	}
+
+	n, err := io.Copy(file, r.Body)
+	if err != nil {
+		discard()
+
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.badRequestResponse(w, r, fmt.Sprintf("body must not be larger than %d bytes", app.config.imports.maxBytes))
+		default:
+			app.badRequestResponse(w, r, "unable to read body")
+		}
+		return
+	}
+
+	if n == 0 {
+		discard()
+		app.badRequestResponse(w, r, "body must not be empty")
+		return
+	}
+
+	imp := &data.MovieImport{
+		UserID: app.contextGetUser(r).ID,
+		Format: format,
+	}
+
+	err = app.models.Imports.Insert(imp)
+	if err != nil {
+		discard()
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The background import works on its own copy, so it can't race with the response.
+	job := *imp
+	app.background(func() {
+		defer discard()
+		app.runMovieImport(&job, file)
+	})
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/movies/imports/%d", imp.ID))
+
+	err = app.writeJSON(w, http.StatusAccepted, envelop{"import": imp}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Show movie import
+// @Description  show the progress of an import and the rows which failed validation, page = 1, page_size=10 by default.
+// @Param id path int true "import id"
+// @Param page query int false "page"
+// @Param page_size query int false "page_size"
+// @Security Bearer
+// @Tags         Movies
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} MovieImportReport
+// @Failure      404  {object} Error
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/imports/{id} [get]
+func (app *application) showMovieImportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	v := validation.New()
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 10, v)
+	input.Sort = "row_number"
+	input.SortSafeList = []string{"row_number"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	imp, err := app.models.Imports.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Imports of other users are reported as not found.
+	if imp.UserID != app.contextGetUser(r).ID {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	rowErrors, metadata, err := app.models.Imports.GetErrors(imp.ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"import": imp, "errors": rowErrors, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// runMovieImport reads the buffered upload row by row, validates each row and inserts the
+// valid movies in batches. Progress is saved after every batch.
+func (app *application) runMovieImport(imp *data.MovieImport, file *os.File) {
+	var (
+		batch     []*data.Movie
+		rowErrors []data.ImportRowError
+	)
+
+	fail := func(message string) {
+		imp.Status = data.ImportFailed
+		imp.Error = message
+
+		err := app.models.Imports.UpdateProgress(imp, rowErrors)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"import_id": strconv.FormatInt(imp.ID, 10)})
+		}
+	}
+
+	flush := func() error {
+		if len(batch) > 0 {
+			err := app.models.Movies.InsertBatch(batch, imp.UserID)
+			if err != nil {
+				return err
+			}
+
+			imp.InsertedRows += int32(len(batch))
+			batch = batch[:0]
+		}
+
+		err := app.models.Imports.UpdateProgress(imp, rowErrors)
+		if err != nil {
+			return err
+		}
+
+		rowErrors = rowErrors[:0]
+		return nil
+	}
+
+	_, err := file.Seek(0, io.SeekStart)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"import_id": strconv.FormatInt(imp.ID, 10)})
+		fail("the import was stopped by an internal error")
+		return
+	}
+
+	rows, err := newMovieRowReader(imp.Format, file)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	// The vocabulary is read once, genres added while the import runs aren't picked up
+	genres, err := app.models.Genres.Vocabulary()
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"import_id": strconv.FormatInt(imp.ID, 10)})
+		fail("the import was stopped by an internal error")
+		return
+	}
+
+	imp.Status = data.ImportRunning
+
+	err = app.models.Imports.UpdateProgress(imp, nil)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"import_id": strconv.FormatInt(imp.ID, 10)})
+		return
+	}
+
+	for {
+		movie, rowErrs, err := rows.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// Save the rows read so far, the rest of the upload can't be read.
+			if flushErr := flush(); flushErr != nil {
+				app.logger.PrintError(flushErr, map[string]string{"import_id": strconv.FormatInt(imp.ID, 10)})
+			}
+			fail(fmt.Sprintf("row %d: %s", imp.TotalRows+1, err))
+			return
+		}
+
+		imp.TotalRows++
+
+		if rowErrs == nil {
+			v := validation.New()
+			if data.ValidateMovie(v, movie, genres); !v.Valid() {
+				rowErrs = v.Errors
+			}
+		}
+
+		if rowErrs != nil {
+			imp.FailedRows++
+			if imp.FailedRows <= maxImportRowErrors {
+				rowErrors = append(rowErrors, data.ImportRowError{Row: imp.TotalRows, Errors: rowErrs})
+			}
+		} else {
+			batch = append(batch, movie)
+		}
+
+		if len(batch) == importBatchSize || len(rowErrors) == importBatchSize {
+			err = flush()
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{"import_id": strconv.FormatInt(imp.ID, 10)})
+				fail("the import was stopped by an internal error")
+				return
+			}
+		}
+	}
+
+	imp.Status = data.ImportCompleted
+
+	err = flush()
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"import_id": strconv.FormatInt(imp.ID, 10)})
+		fail("the import was stopped by an internal error")
+	}
+}
+
+// importFormat returns the format of an import, from the format query parameter or else
+// the Content-Type of the request.
+func importFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "application/json":
+		return "json"
+	case "application/x-ndjson", "application/jsonl":
+		return "ndjson"
+	case "text/csv":
+		return "csv"
+	default:
+		return ""
+	}
+}
+
+type importRow struct {
+	Title   string       `json:"title"`
+	Year    int32        `json:"year"`
+	Runtime data.Runtime `json:"runtime"`
+	Genres  []string     `json:"genres"`
+}
+
+func (row importRow) movie() *data.Movie {
+	return &data.Movie{
+		Title:   row.Title,
+		Year:    row.Year,
+		Runtime: row.Runtime,
+		Genres:  row.Genres,
+	}
+}
+
+// movieRowReader reads the rows of an import one at a time. next returns the movie of the
+// next row, or the errors which make the row unreadable, and io.EOF after the last row.
+// Any other error means the rest of the upload can't be read.
+type movieRowReader interface {
+	next() (*data.Movie, validation.MapErrors, error)
+}
+
+func newMovieRowReader(format string, r io.Reader) (movieRowReader, error) {
+	switch format {
+	case "csv":
+		return newCSVRowReader(r)
+	case "ndjson":
+		return newNDJSONRowReader(r), nil
+	}
+
+	// A JSON upload is either an array of movies or, like NDJSON, one movie per line.
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return newNDJSONRowReader(br), nil
+			}
+			return nil, err
+		}
+
+		if unicode.IsSpace(rune(b)) {
+			continue
+		}
+
+		if err = br.UnreadByte(); err != nil {
+			return nil, err
+		}
+
+		if b == '[' {
+			return newJSONArrayRowReader(br)
+		}
+		return newNDJSONRowReader(br), nil
+	}
+}
+
+type ndjsonRowReader struct {
+	scanner *bufio.Scanner
+}
+
+func newNDJSONRowReader(r io.Reader) *ndjsonRowReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineBytes)
+
+	return &ndjsonRowReader{scanner: scanner}
+}
+
+func (n *ndjsonRowReader) next() (*data.Movie, validation.MapErrors, error) {
+	for n.scanner.Scan() {
+		line := n.scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var row importRow
+
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+
+		err := dec.Decode(&row)
+		if err == nil && dec.More() {
+			err = errors.New("must only contain a single JSON value")
+		}
+		if err != nil {
+			var syntaxError *json.SyntaxError
+			if errors.As(err, &syntaxError) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, validation.MapErrors{"row": "contains badly-formed JSON"}, nil
+			}
+			return nil, jsonRowErrors(err), nil
+		}
+
+		return row.movie(), nil, nil
+	}
+
+	if err := n.scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, nil, fmt.Errorf("line is longer than %d bytes", maxImportLineBytes)
+		}
+		return nil, nil, err
+	}
+
+	return nil, nil, io.EOF
+}
+
+type jsonArrayRowReader struct {
+	dec *json.Decoder
+}
+
+func newJSONArrayRowReader(r io.Reader) (*jsonArrayRowReader, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	// Consume the opening bracket.
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	return &jsonArrayRowReader{dec: dec}, nil
+}
+
+func (j *jsonArrayRowReader) next() (*data.Movie, validation.MapErrors, error) {
+	if !j.dec.More() {
+		// Consume the closing bracket, reporting a truncated upload.
+		if _, err := j.dec.Token(); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, io.EOF
+	}
+
+	var row importRow
+
+	err := j.dec.Decode(&row)
+	if err != nil {
+		// A syntax error leaves the decoder in the middle of the array, so it stops the
+		// import. Other errors only affect the current row.
+		var syntaxError *json.SyntaxError
+		if errors.As(err, &syntaxError) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			return nil, nil, fmt.Errorf("body contains badly-formed JSON: %w", err)
+		}
+		return nil, jsonRowErrors(err), nil
+	}
+
+	return row.movie(), nil, nil
+}
+
+// jsonRowErrors describes why a well-formed JSON row couldn't be decoded into a movie.
+func jsonRowErrors(err error) validation.MapErrors {
+	var unmarshalTypeError *json.UnmarshalTypeError
+
+	switch {
+	case errors.Is(err, data.ErrInvalidRuntimeFormat):
+		return validation.MapErrors{"runtime": `must be a number of minutes, e.g. 102, "102 mins", "1h 42m" or "PT1H42M"`}
+	case errors.As(err, &unmarshalTypeError):
+		if unmarshalTypeError.Field != "" {
+			return validation.MapErrors{unmarshalTypeError.Field: "has an incorrect JSON type"}
+		}
+		return validation.MapErrors{"row": "must be a JSON object"}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return validation.MapErrors{"row": "contains unknown key " + strings.TrimPrefix(err.Error(), "json: unknown field ")}
+	default:
+		return validation.MapErrors{"row": err.Error()}
+	}
+}
+
+var importColumns = []string{"title", "year", "runtime", "genres"}
+
+type csvRowReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+// newCSVRowReader reads the header row, which must name each of the title, year, runtime
+// and genres columns once, in any order.
+func newCSVRowReader(r io.Reader) (*csvRowReader, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("missing CSV header")
+		}
+		return nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+
+		if !validation.PermittedValue(name, importColumns...) {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		if _, exists := columns[name]; exists {
+			return nil, fmt.Errorf("duplicate CSV column %q", name)
+		}
+
+		columns[name] = i
+	}
+
+	for _, name := range importColumns {
+		if _, exists := columns[name]; !exists {
+			return nil, fmt.Errorf("missing CSV column %q", name)
+		}
+	}
+
+	return &csvRowReader{r: cr, columns: columns}, nil
+}
+
+// next reads a CSV row. Runtime is in any of the forms data.ParseRuntime reads, like "102"
+// or "1h 42m", and genres are separated by commas within the cell.
+func (c *csvRowReader) next() (*data.Movie, validation.MapErrors, error) {
+	record, err := c.r.Read()
+	if err != nil {
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) && errors.Is(parseError.Err, csv.ErrFieldCount) {
+			return nil, validation.MapErrors{"row": fmt.Sprintf("must have %d fields", len(c.columns))}, nil
+		}
+		return nil, nil, err
+	}
+
+	v := validation.New()
+
+	year, err := strconv.ParseInt(strings.TrimSpace(record[c.columns["year"]]), 10, 32)
+	v.Check(err == nil, "year", "must be an integer")
+
+	runtime, err := data.ParseRuntime(record[c.columns["runtime"]])
+	v.Check(err == nil, "runtime", `must be a number of minutes, e.g. 102, "102 mins", "1h 42m" or "PT1H42M"`)
+
+	if !v.Valid() {
+		return nil, v.Errors, nil
+	}
+
+	genres := []string{}
+	for _, genre := range strings.Split(record[c.columns["genres"]], ",") {
+		if genre = strings.TrimSpace(genre); genre != "" {
+			genres = append(genres, genre)
+		}
+	}
+
+	movie := &data.Movie{
+		Title:   strings.TrimSpace(record[c.columns["title"]]),
+		Year:    int32(year),
+		Runtime: runtime,
+		Genres:  genres,
+	}
+
+	return movie, nil, nil
+}
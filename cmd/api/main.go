@@ -11,7 +11,10 @@ import (
 	"github.com/minhnghia2k3/greenlight/docs"
 	"github.com/minhnghia2k3/greenlight/internal/data"
 	"github.com/minhnghia2k3/greenlight/internal/jsonlog"
+	"github.com/minhnghia2k3/greenlight/internal/jwtkeys"
 	"github.com/minhnghia2k3/greenlight/internal/mailer"
+	"github.com/minhnghia2k3/greenlight/internal/storage"
+	"github.com/minhnghia2k3/greenlight/internal/validation"
 	"github.com/minhnghia2k3/greenlight/internal/vcs"
 	"log"
 	"os"
@@ -52,18 +55,49 @@ type config struct {
 		trustedOrigins []string
 	}
 	jwt struct {
-		secret string
-		issuer string
+		secret     string
+		keysDir    string
+		activeKey  string
+		issuer     string
+		accessTTL  time.Duration
+		refreshTTL time.Duration
+	}
+	search struct {
+		config string
+	}
+	runtime struct {
+		format string
+	}
+	idempotency struct {
+		ttl time.Duration
+	}
+	trash struct {
+		retention time.Duration
+	}
+	imports struct {
+		maxBytes int64
+		dir      string
+	}
+	conditional struct {
+		requireIfMatch bool
+	}
+	images struct {
+		maxBytes int64
+	}
+	storage struct {
+		dir string
 	}
 }
 
 // Application struct hold the HTTP handlers, helpers, and middleware
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models *data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config  config
+	logger  *jsonlog.Logger
+	models  *data.Models
+	mailer  mailer.Mailer
+	storage storage.Storage
+	keys    *jwtkeys.KeySet
+	wg      sync.WaitGroup
 }
 
 // @title Greenlight Public API
@@ -107,8 +141,12 @@ func main() {
 	// APPLICATION
 	flag.IntVar(&cfg.port, "port", intPort, "API server port")
 	flag.StringVar(&cfg.env, "env", os.Getenv("ENVIRONMENT"), "Environment (development|staging|production)")
-	flag.StringVar(&cfg.jwt.secret, "jwt-secret", os.Getenv("JWT_SECRET"), "JWT secret")
+	flag.StringVar(&cfg.jwt.secret, "jwt-secret", os.Getenv("JWT_SECRET"), "JWT secret, used with HS256 under the key ID \"default\"")
+	flag.StringVar(&cfg.jwt.keysDir, "jwt-keys-dir", os.Getenv("JWT_KEYS_DIR"), "Directory of JWT signing keys, <kid>.pem or <kid>.secret files reloaded on SIGHUP")
+	flag.StringVar(&cfg.jwt.activeKey, "jwt-active-key", os.Getenv("JWT_ACTIVE_KEY"), "ID of the key JWTs are signed with (default the key ID sorting last)")
 	flag.StringVar(&cfg.jwt.issuer, "jwt-issuer", os.Getenv("JWT_ISSUER"), "JWT issuer")
+	flag.DurationVar(&cfg.jwt.accessTTL, "jwt-access-ttl", 15*time.Minute, "How long an access JWT is valid")
+	flag.DurationVar(&cfg.jwt.refreshTTL, "jwt-refresh-ttl", 30*24*time.Hour, "How long a refresh token is valid, each use issues a new one")
 
 	// POSTGRES DATABASE
 	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("DATABASE_URL"), "PostgreSQL DSN")
@@ -128,6 +166,29 @@ func main() {
 	flag.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("SMTP_PASSWORD"), "SMTP password")
 	flag.StringVar(&cfg.smtp.sender, "smtp-sender", os.Getenv("SMTP_SENDER"), "SMTP sender")
 
+	// TRASH
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted movies are kept before they can be purged")
+
+	// CONDITIONAL REQUESTS
+	flag.BoolVar(&cfg.conditional.requireIfMatch, "require-if-match", false, "Reject movie writes without an If-Match header")
+
+	// BULK IMPORTS
+	flag.Int64Var(&cfg.imports.maxBytes, "import-max-bytes", 512<<20, "Maximum size of a movie import upload in bytes")
+	flag.StringVar(&cfg.imports.dir, "import-dir", "", "Directory where uploads are buffered while imported (default the system temporary directory)")
+
+	// IMAGES
+	flag.Int64Var(&cfg.images.maxBytes, "image-max-bytes", 10<<20, "Maximum size of a poster or backdrop upload in bytes")
+	flag.StringVar(&cfg.storage.dir, "storage-dir", "./uploads", "Directory where uploaded images are stored")
+
+	// IDEMPOTENCY KEYS
+	flag.DurationVar(&cfg.idempotency.ttl, "idempotency-ttl", 24*time.Hour, "How long the responses to requests with an Idempotency-Key header are replayed")
+
+	// FULL-TEXT SEARCH
+	flag.StringVar(&cfg.search.config, "search-config", "simple", "Default PostgreSQL text-search configuration (simple|english|...)")
+
+	// RUNTIME FORMAT
+	flag.StringVar(&cfg.runtime.format, "runtime-format", data.RuntimeFormatMins, "Form movie runtimes are written in (mins|minutes|iso8601)")
+
 	flag.Func("cors-trusted-origins", "Trusted CORS origin (space separated)", func(val string) error {
 		cfg.cors.trustedOrigins = strings.Fields(val)
 		return nil
@@ -145,6 +206,15 @@ func main() {
 	// Creates a new Logger which writes to the std out stream
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
+	if !validation.PermittedValue(cfg.search.config, data.SearchConfigs...) {
+		logger.PrintFatal(fmt.Errorf("unsupported search config %q", cfg.search.config), nil)
+	}
+
+	if !validation.PermittedValue(cfg.runtime.format, data.RuntimeFormats...) {
+		logger.PrintFatal(fmt.Errorf("unsupported runtime format %q", cfg.runtime.format), nil)
+	}
+	data.RuntimeFormat = cfg.runtime.format
+
 	// Create a connection pool
 	db, err := openDB(cfg)
 	if err != nil {
@@ -152,6 +222,16 @@ func main() {
 	}
 	defer db.Close()
 
+	store, err := storage.NewLocal(cfg.storage.dir)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	keys, err := jwtkeys.Load(cfg.jwt.keysDir, cfg.jwt.activeKey, []byte(cfg.jwt.secret))
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	// Metrics
 	expvar.NewString("version").Set(version)
 
@@ -172,10 +252,12 @@ func main() {
 
 	// Declare an instance of application struct
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:  cfg,
+		logger:  logger,
+		models:  data.NewModels(db),
+		mailer:  mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		storage: store,
+		keys:    keys,
 	}
 
 	logger.PrintInfo("database connection pool established", nil)
@@ -1,14 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"errors"
 	"expvar"
 	"fmt"
 	"github.com/minhnghia2k3/greenlight/internal/data"
-	"github.com/pascaldekloe/jwt"
 	"github.com/tomasen/realip"
 	"golang.org/x/time/rate"
+	"io"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -21,12 +24,27 @@ type metricsResponseWriter struct {
 	headerWritten bool
 }
 
+// idempotencyResponseWriter records the response of a request made with an idempotency
+// key while writing it through, so it can be replayed on retries.
+type idempotencyResponseWriter struct {
+	wrapped       http.ResponseWriter
+	before        http.Header // headers set before the handler ran, e.g. by CORS
+	response      data.IdempotentResponse
+	headerWritten bool
+}
+
 // ================== APPLICATION MIDDLEWARES
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// defer function which always be run in the event of panic
 		defer func() {
 			if err := recover(); err != nil {
+				// A handler aborting a response already under way wants the connection reset,
+				// not an error response appended to what it sent
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+
 				w.Header().Set("Connection", "close")
 				app.serverErrorResponse(w, r, fmt.Errorf("%s", err))
 			}
@@ -112,11 +130,12 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 			for i := range app.config.cors.trustedOrigins {
 				if origin == app.config.cors.trustedOrigins[i] {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
+					w.Header().Set("Access-Control-Expose-Headers", "ETag, Location, Idempotent-Replayed")
 
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 						// Set the preflight response headers
 						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authentication, Content-Type")
+						w.Header().Set("Access-Control-Allow-Headers", "Authentication, Content-Type, If-Match, If-None-Match, Idempotency-Key")
 
 						w.WriteHeader(http.StatusOK)
 					}
@@ -157,7 +176,7 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		token := headerParts[1]
 
 		// Parse the JWT and extract the claims
-		claims, err := jwt.HMACCheck([]byte(token), []byte(app.config.jwt.secret))
+		claims, err := app.keys.Check([]byte(token))
 		if err != nil {
 			app.invalidAuthenticationTokenResponse(w, r)
 			return
@@ -195,8 +214,27 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		// Reject tokens issued before the user revoked them all, e.g. by changing password,
+		// and tokens revoked one by one on logout
+		if claims.ID == "" || claims.Expires == nil || claims.Issued == nil || claims.Issued.Time().Before(user.TokensValidAfter) {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		revoked, err := app.models.Revocations.IsRevoked(claims.ID, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if revoked {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
 		// Add the user record to the request context
 		r = app.contextSetUser(r, user)
+		r = app.contextSetClaims(r, claims)
 
 		// Call the next handler chain
 		next.ServeHTTP(w, r)
@@ -258,6 +296,152 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 	return app.requireActivatedUser(fn)
 }
 
+// ================== IDEMPOTENCY MIDDLEWARES
+
+// idempotent makes retries of a POST request safe: a request with an Idempotency-Key
+// header is processed once, and retries with the same key and body get the stored
+// response replayed. A key reused with a different body is rejected. Responses with a
+// server error aren't stored, so those requests can be retried.
+func (app *application) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return app.idempotency(next, true)
+}
+
+// idempotentSecret is idempotent for requests whose responses hold secrets, like tokens.
+// Only the status of the response is stored, and retries are refused instead of replayed.
+func (app *application) idempotentSecret(next http.HandlerFunc) http.HandlerFunc {
+	return app.idempotency(next, false)
+}
+
+func (app *application) idempotency(next http.HandlerFunc, replay bool) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idempotencyKey := r.Header.Get("Idempotency-Key")
+		if idempotencyKey == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(idempotencyKey) > 255 {
+			app.badRequestResponse(w, r, "Idempotency-Key header must not be more than 255 bytes long")
+			return
+		}
+
+		// The body is read here to fingerprint it, and handed on to the handler
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1_048_576))
+		if err != nil {
+			app.badRequestResponse(w, r, "body must not be larger than 1048576 bytes")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// The query string is part of the request, e.g. ?force=true. Only a hash is stored,
+		// the body may hold a password
+		fingerprint := sha256.Sum256(append([]byte(r.URL.RawQuery+"\n"), body...))
+
+		key := &data.IdempotencyKey{
+			UserID:      app.contextGetUser(r).ID,
+			Method:      r.Method,
+			Path:        r.URL.Path,
+			Key:         idempotencyKey,
+			Fingerprint: fingerprint[:],
+		}
+
+		stored, err := app.models.Idempotency.Begin(key, app.config.idempotency.ttl)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrIdempotencyKeyReused):
+				app.errorResponse(w, r, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+			case errors.Is(err, data.ErrIdempotencyKeyInProgress):
+				app.errorResponse(w, r, http.StatusConflict, "a request with this Idempotency-Key is still being processed")
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if stored != nil && !replay {
+			app.errorResponse(w, r, http.StatusConflict, "a request with this Idempotency-Key was already processed")
+			return
+		}
+
+		if stored != nil {
+			for name, values := range stored.Header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.Status)
+			w.Write(stored.Body)
+			return
+		}
+
+		iw := &idempotencyResponseWriter{wrapped: w, before: w.Header().Clone()}
+
+		// The key is released unless the response is stored, also when the handler panics
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+
+			err := app.models.Idempotency.Release(key)
+			if err != nil {
+				app.logError(r, err)
+			}
+		}()
+
+		next.ServeHTTP(iw, r)
+
+		if iw.response.Status >= http.StatusInternalServerError {
+			return
+		}
+
+		response := &iw.response
+		if !replay {
+			response = &data.IdempotentResponse{Status: response.Status}
+		}
+
+		err = app.models.Idempotency.Complete(key, response)
+		if err != nil {
+			app.logError(r, err)
+			return
+		}
+		completed = true
+	})
+}
+
+func (iw *idempotencyResponseWriter) WriteHeader(statusCode int) {
+	if !iw.headerWritten {
+		iw.response.Status = statusCode
+		iw.headerWritten = true
+
+		// Only the headers set by the handler are replayed
+		iw.response.Header = make(map[string][]string)
+		for name, values := range iw.wrapped.Header() {
+			if !slices.Equal(values, iw.before[name]) {
+				iw.response.Header[name] = values
+			}
+		}
+	}
+
+	iw.wrapped.WriteHeader(statusCode)
+}
+
+func (iw *idempotencyResponseWriter) Write(b []byte) (int, error) {
+	if !iw.headerWritten {
+		iw.WriteHeader(http.StatusOK)
+	}
+
+	iw.response.Body = append(iw.response.Body, b...)
+	return iw.wrapped.Write(b)
+}
+
+func (iw *idempotencyResponseWriter) Unwrap() http.ResponseWriter {
+	return iw.wrapped
+}
+
+func (iw *idempotencyResponseWriter) Header() http.Header {
+	return iw.wrapped.Header()
+}
+
 // ================== METRICS MIDDLEWARES
 func (app *application) metrics(next http.Handler) http.Handler {
 	// Initialize the new expvar variables when the middleware chain is first built
@@ -1,45 +1,72 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/minhnghia2k3/greenlight/internal/data"
+	"github.com/minhnghia2k3/greenlight/internal/jsonpatch"
 	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"mime"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 )
 
 type MovieInput struct {
 	Title   *string       `json:"title" example:"Black panther"`
 	Year    *int32        `json:"year" example:"2018"`
 	Runtime *data.Runtime `json:"runtime" example:"195 mins"`
-	Genres  []string      `json:"genres" example:"actions,sci-fi"` // Don't need to set to a pointer, bc slices already heave zero-values nil
+	Genres  []string      `json:"genres" example:"action,sci-fi"` // Don't need to set to a pointer, bc slices already heave zero-values nil
 }
 
 type MovieInputDocs struct {
 	Title   *string  `json:"title" example:"Black panther"`
 	Year    *int32   `json:"year" example:"2018"`
 	Runtime *string  `json:"runtime" example:"195 mins"`
-	Genres  []string `json:"genres" example:"actions,sci-fi"` // Don't need to set to a pointer, bc slices already heave zero-values nil
+	Genres  []string `json:"genres" example:"action,sci-fi"` // Don't need to set to a pointer, bc slices already heave zero-values nil
 }
 
 type ListMovies struct {
 	Data     data.Movie    `json:"data"`
 	Metadata data.Metadata `json:"metadata"`
+	Facets   data.Facets   `json:"facets,omitempty"`
 }
 
 type MovieResponse struct {
 	Movie data.Movie `json:"movie"`
 }
 
+type DuplicateMovies struct {
+	Error      string       `json:"error" example:"the movie looks like a duplicate of existing movies"`
+	Duplicates []data.Movie `json:"duplicates"`
+}
+
+type MergeMovieInput struct {
+	CanonicalID int64 `json:"canonical_id" example:"1"`
+}
+
+type MovieSuggestions struct {
+	Suggestions []data.MovieSuggestion `json:"suggestions"`
+}
+
 // @Summary      Create movie
-// @Description  handlers receives MovieInputDocs, validate it then create a new movie record
+// @Description  handlers receives MovieInputDocs, validate it then create a new movie record.
+// @Description  a movie with the same year and title, ignoring case, spaces and punctuation, is a likely duplicate and is rejected with 409 listing the duplicates, unless force=true.
 // @Param input body MovieInputDocs true "create movie payload"
+// @Param force query bool false "create the movie even if it looks like a duplicate"
+// @Param fuzzy query bool false "also treat movies a year apart or with a similar title as duplicates"
+// @Param Idempotency-Key header string false "unique key of the request, retries with the same key replay the first response"
 // @Tags         Movies
 // @Accept 		 json
 // @Produce      json
 // @Security Bearer
 // @Success      201  {object} MovieResponse
 // @Failure      400  {object} Error
+// @Failure      409  {object} DuplicateMovies
 // @Failure      422  {object} Error
 // @Failure      500  {object} Error
 // @Router       /movies [post]
@@ -61,14 +88,45 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		Genres:  input.Genres,
 	}
 
+	genres, err := app.models.Genres.Vocabulary()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	v := validation.New()
+	qs := r.URL.Query()
 
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	force := app.readBool(qs, "force", false, v)
+	fuzzy := app.readBool(qs, "fuzzy", false, v)
+
+	if data.ValidateMovie(v, movie, genres); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 
-	} // Store data.
-	err = app.models.Movies.Insert(movie)
+	}
+
+	// Likely duplicates are listed, so the client can use one of them or force the insert
+	if !force {
+		duplicates, err := app.models.Movies.FindDuplicates(movie, fuzzy)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if len(duplicates) > 0 {
+			env := envelop{"error": "the movie looks like a duplicate of existing movies", "duplicates": duplicates}
+
+			err = app.writeJSON(w, http.StatusConflict, env, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	// Store data.
+	err = app.models.Movies.Insert(movie, app.contextGetUser(r).ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -78,6 +136,7 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	// know which URL they can find the newly-created
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	headers.Set("ETag", versionETag(movie.Version))
 
 	err = app.writeJSON(w, http.StatusCreated, envelop{"movie": movie}, headers)
 	if err != nil {
@@ -89,47 +148,226 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 // It will get the URL query, query integer parameters, and response list of movies to client.
 // @Summary      List movies
 // @Description  show list movies, page = 1, page_size=10 by default.
+// @Description  pass metadata.next_cursor as cursor to page by keyset instead of by page number.
 // @Param page query int false "page"
 // @Param page_size query int false "page_size"
+// @Param cursor query string false "cursor"
 // @Param title query string false "title"
-// @Param genres query string false "genres"
-// @Param sort query string false "sort"
+// @Param genres query string false "movies with all of these genres"
+// @Param genres_any query string false "movies with at least one of these genres"
+// @Param genres_exclude query string false "movies with none of these genres"
+// @Param year_min query int false "earliest year"
+// @Param year_max query int false "latest year"
+// @Param runtime_min query int false "shortest runtime in minutes"
+// @Param runtime_max query int false "longest runtime in minutes"
+// @Param created_after query string false "added after, RFC 3339 timestamp or YYYY-MM-DD date"
+// @Param created_before query string false "added before, RFC 3339 timestamp or YYYY-MM-DD date"
+// @Param person query int false "person id"
+// @Param q query string false "full-text search, supports \"phrases\", -exclusion and OR"
+// @Param search_config query string false "text-search configuration, e.g. english"
+// @Param fuzzy query bool false "also match titles similar to q, to tolerate typos"
+// @Param sort query string false "comma-separated sort keys, e.g. -year,title"
+// @Param fields query string false "comma-separated fields to return, e.g. id,title,year"
+// @Param expand query string false "comma-separated related resources to embed: credits, reviews"
+// @Param facets query string false "comma-separated facets to count over every match: genres, decade, runtime"
+// @Param lang query string false "language of the titles, e.g. fr or pt-BR, preferred over Accept-Language"
+// @Param Accept-Language header string false "preferred languages of the titles"
 // @Security Bearer
 // @Tags         Movies
 // @Accept 		 json
 // @Produce      json
 // @Success      200  {object} ListMovies
+// @Failure      422  {object} Error
 // @Failure      500  {object} Error
 // @Router       /movies [get]
 func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title  string
-		Genres []string
+		Criteria data.MovieCriteria
+		Facets   []string
 		data.Filters
+		data.Projection
 	}
 
 	v := validation.New()
 	qs := r.URL.Query()
 
 	// Read query parameters
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", []string{})
+	input.Criteria.Title = app.readString(qs, "title", "")
+	input.Criteria.Genres = app.readCSV(qs, "genres", []string{})
+	input.Criteria.GenresAny = app.readCSV(qs, "genres_any", []string{})
+	input.Criteria.GenresExclude = app.readCSV(qs, "genres_exclude", []string{})
+	input.Criteria.YearMin = int32(app.readInt(qs, "year_min", 0, v))
+	input.Criteria.YearMax = int32(app.readInt(qs, "year_max", 0, v))
+	input.Criteria.RuntimeMin = data.Runtime(app.readInt(qs, "runtime_min", 0, v))
+	input.Criteria.RuntimeMax = data.Runtime(app.readInt(qs, "runtime_max", 0, v))
+	input.Criteria.CreatedAfter = app.readTime(qs, "created_after", v)
+	input.Criteria.CreatedBefore = app.readTime(qs, "created_before", v)
+	input.Criteria.Person = int64(app.readInt(qs, "person", 0, v))
+	input.Criteria.Search.Query = app.readString(qs, "q", "")
+	input.Criteria.Search.Config = app.readString(qs, "search_config", app.config.search.config)
+	input.Criteria.Search.Fuzzy = app.readBool(qs, "fuzzy", false, v)
 	input.Page = app.readInt(qs, "page", 1, v)
 	input.PageSize = app.readInt(qs, "page_size", 10, v)
 	input.Sort = app.readString(qs, "sort", "id")
-	input.SortSafeList = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.Cursor = app.readString(qs, "cursor", "")
+	input.SortSafeList = []string{"id", "title", "year", "runtime", "average_rating", "rating_count", "relevance",
+		"-id", "-title", "-year", "-runtime", "-average_rating", "-rating_count"}
+	input.Fields = app.readCSV(qs, "fields", nil)
+	input.FieldSafeList = append(slices.Clone(data.MovieFields), "relevance", "highlight")
+	input.Expand = app.readCSV(qs, "expand", nil)
+	input.ExpandSafeList = movieExpandSafeList
+	input.Facets = app.readCSV(qs, "facets", nil)
+	input.Languages = app.readLanguages(r, v)
+	v.Check(!input.SortsBy("relevance") || input.Criteria.Search.Query != "", "sort", "relevance requires a q search")
+	data.ValidateMovieCriteria(v, input.Criteria)
+	data.ValidateProjection(v, input.Projection)
+	data.ValidateFacets(v, input.Facets)
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
+	// Genre filters may use any spelling of a genre, movies store the slugs
+	genres, err := app.models.Genres.Vocabulary()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	input.Criteria.Genres = genres.Canonical(input.Criteria.Genres)
+	input.Criteria.GenresAny = genres.Canonical(input.Criteria.GenresAny)
+	input.Criteria.GenresExclude = genres.Canonical(input.Criteria.GenresExclude)
+
 	// Get list movies
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := app.models.Movies.GetAll(input.Criteria, input.Filters, input.Projection)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelop{"metadata": metadata, "movies": movies}, nil)
+
+	err = app.expandMovies(movies, input.Projection)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	records := make([]any, len(movies))
+	for i, movie := range movies {
+		records[i], err = project(movie, input.Projection)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	env := envelop{"metadata": metadata, "movies": records}
+
+	// Facets are counted over every match of the filters, not only the current page
+	if len(input.Facets) > 0 {
+		env["facets"], err = app.models.Movies.Facets(input.Criteria, input.Facets)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// Offer similar titles when a search found nothing, most likely a typo
+	if search := cmp.Or(input.Criteria.Search.Query, input.Criteria.Title); len(movies) == 0 && search != "" {
+		env["did_you_mean"], err = app.models.Movies.DidYouMean(search, 5)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// Titles are localized from the Accept-Language header. Vary is added to, not set, to
+	// keep the values of the CORS and authentication middleware.
+	w.Header().Add("Vary", "Accept-Language")
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// movieExpandSafeList lists the related resources which can be embedded in movies.
+var movieExpandSafeList = []string{"credits", "reviews"}
+
+// expandedReviews is how many of the latest reviews are embedded in an expanded movie.
+const expandedReviews = 5
+
+// expandMovies embeds the related resources requested by a projection in the movies: the
+// director, cast and crew credits, and the latest reviews.
+func (app *application) expandMovies(movies []*data.Movie, p data.Projection) error {
+	if len(movies) == 0 || len(p.Expand) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+
+	if p.Expands("credits") {
+		credits, err := app.models.Credits.GetForMovies(ids)
+		if err != nil {
+			return err
+		}
+
+		for _, movie := range movies {
+			movie.Credits = credits[movie.ID]
+		}
+	}
+
+	if p.Expands("reviews") {
+		reviews, err := app.models.Reviews.GetLatestForMovies(ids, expandedReviews)
+		if err != nil {
+			return err
+		}
+
+		for _, movie := range movies {
+			movie.Reviews = reviews[movie.ID]
+		}
+	}
+
+	return nil
+}
+
+// @Summary      Suggest movie titles
+// @Description  autocomplete movie titles, or words in a title, starting with the prefix
+// @Param prefix query string true "prefix"
+// @Param limit query int false "maximum number of suggestions, 10 by default"
+// @Security Bearer
+// @Tags         Movies
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} MovieSuggestions
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/suggest [get]
+func (app *application) suggestMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validation.New()
+	qs := r.URL.Query()
+
+	prefix := strings.TrimSpace(app.readString(qs, "prefix", ""))
+	limit := app.readInt(qs, "limit", 10, v)
+
+	v.Check(prefix != "", "prefix", "must be provided")
+	v.Check(len(prefix) <= 100, "prefix", "must not be more than 100 bytes long")
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 20, "limit", "must be a maximum of 20")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	suggestions, err := app.models.Movies.Suggest(prefix, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"suggestions": suggestions}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -137,14 +375,22 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 
 // showMovieHandler handler
 // @Summary      Get movie by id
-// @Description  get movie by provided movie id
+// @Description  get movie by provided movie id, including its director, cast and crew credits. The title is localized to the best match of the lang parameter or Accept-Language header, with original_title set when it differs.
 // @Param id path int true "id"
+// @Param fields query string false "comma-separated fields to return, e.g. id,title,year"
+// @Param expand query string false "comma-separated related resources to embed: credits (the default without fields), reviews"
+// @Param lang query string false "language of the title, e.g. fr or pt-BR, preferred over Accept-Language"
+// @Param Accept-Language header string false "preferred languages of the title"
+// @Param If-None-Match header string false "ETag of a cached copy"
 // @Tags         Movies
 // @Accept 		 json
 // @Produce      json
 // @Security Bearer
-// @Success      200  {object} ListMovies
+// @Success      200  {object} MovieResponse
+// @Success      304
+// @Success      301  {object} MessageResponse
 // @Failure      404  {object} Error
+// @Failure      422  {object} Error
 // @Failure      500  {object} Error
 // @Router       /movies/{id} [get]
 func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request) {
@@ -154,11 +400,34 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	movie, err := app.models.Movies.Get(id)
+	var input data.Projection
+
+	v := validation.New()
+	qs := r.URL.Query()
+
+	input.Fields = app.readCSV(qs, "fields", nil)
+	input.FieldSafeList = data.MovieFields
+	input.ExpandSafeList = movieExpandSafeList
+
+	// The credits are embedded by default, unless specific fields were asked for
+	if len(input.Fields) == 0 {
+		input.Expand = app.readCSV(qs, "expand", []string{"credits"})
+	} else {
+		input.Expand = app.readCSV(qs, "expand", nil)
+	}
+
+	input.Languages = app.readLanguages(r, v)
+
+	if data.ValidateProjection(v, input); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.GetFields(id, input)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
+			app.redirectMergedMovie(w, r, id)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -166,7 +435,60 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelop{"movie": movie}, nil)
+	// Titles are localized from the Accept-Language header. Vary is added to, not set, to
+	// keep the values of the CORS and authentication middleware.
+	w.Header().Add("Vary", "Accept-Language")
+
+	// The entity tag follows the version, so a cached copy is current until the movie is
+	// updated. Each language variant has its own tag.
+	headers := make(http.Header)
+	headers.Set("ETag", localizedETag(movie.Version, input.Languages))
+
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, headers.Get("ETag"), true) {
+		w.Header().Set("ETag", headers.Get("ETag"))
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	err = app.expandMovies([]*data.Movie{movie}, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	record, err := project(movie, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"movie": record}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// redirectMergedMovie answers a request for a movie which doesn't exist. Movies merged
+// into another redirect permanently to it, keeping the query string; any other id is not
+// found.
+func (app *application) redirectMergedMovie(w http.ResponseWriter, r *http.Request, id int64) {
+	canonicalID, err := app.models.Movies.Redirect(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	location := url.URL{Path: fmt.Sprintf("/v1/movies/%d", canonicalID), RawQuery: r.URL.RawQuery}
+
+	headers := make(http.Header)
+	headers.Set("Location", location.String())
+
+	err = app.writeJSON(w, http.StatusMovedPermanently, envelop{"message": "the movie was merged into another movie", "movie_id": canonicalID}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -174,17 +496,22 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 
 // updateMovieHandler which query to get a movie by parameter id and update with input variables.
 // @Summary      Update movie
-// @Description  update an existing movie record
+// @Description  update an existing movie record. Besides a partial movie as application/json, the body can be a JSON Merge Patch (application/merge-patch+json) or a JSON Patch with add, remove, replace and test operations (application/json-patch+json).
 // @Param id path int true "id"
 // @Param input body MovieInputDocs true "update movie payload"
+// @Param If-Match header string false "ETag of the version being changed"
 // @Security Bearer
 // @Tags         Movies
 // @Accept 		 json
+// @Accept 		 application/merge-patch+json
+// @Accept 		 application/json-patch+json
 // @Produce      json
 // @Success      200  {object} MovieResponse
 // @Failure      400  {object} Error
 // @Failure      404  {object} Error
+// @Failure      412  {object} Error
 // @Failure      422  {object} Error
+// @Failure      428  {object} Error
 // @Failure      500  {object} Error
 // @Router       /movies/{id} [patch]
 func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Request) {
@@ -206,42 +533,64 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Read input data then validate
-	var input MovieInput
-
-	err = app.readJSON(w, r, &input)
-	if err != nil {
-		app.badRequestResponse(w, r, err.Error())
+	if !app.checkIfMatch(w, r, versionETag(movie.Version)) {
 		return
 	}
 
-	if input.Title != nil {
-		movie.Title = *input.Title
-	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
 
-	if input.Year != nil {
-		movie.Year = *input.Year
-	}
+	switch mediaType {
+	case "application/merge-patch+json", "application/json-patch+json":
+		if !app.patchMovie(w, r, mediaType, movie) {
+			return
+		}
+	default:
+		// Read input data then validate
+		var input MovieInput
+
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err.Error())
+			return
+		}
 
-	if input.Runtime != nil {
-		movie.Runtime = *input.Runtime
+		if input.Title != nil {
+			movie.Title = *input.Title
+		}
+
+		if input.Year != nil {
+			movie.Year = *input.Year
+		}
+
+		if input.Runtime != nil {
+			movie.Runtime = *input.Runtime
+		}
+
+		if input.Genres != nil {
+			movie.Genres = input.Genres
+		}
 	}
 
-	if input.Genres != nil {
-		movie.Genres = input.Genres
+	genres, err := app.models.Genres.Vocabulary()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	v := validation.New()
 
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	if data.ValidateMovie(v, movie, genres); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
 	// Update to store the updated movie record in our database.
-	err = app.models.Movies.Update(movie)
+	err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrConflictEdit) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+			return
 		case errors.Is(err, data.ErrConflictEdit):
 			app.editConflictResponse(w, r)
 			return
@@ -251,21 +600,121 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelop{"movies": movie}, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", versionETag(movie.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"movies": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// patchMovie applies a JSON Merge Patch or a JSON Patch from the request body to the
+// editable fields of a movie. When it returns false an error response has already been
+// sent.
+func (app *application) patchMovie(w http.ResponseWriter, r *http.Request, mediaType string, movie *data.Movie) bool {
+	// The patch is applied to the movie as clients see it in responses.
+	current, err := json.Marshal(data.MovieSnapshot{
+		Title:   movie.Title,
+		Year:    movie.Year,
+		Runtime: movie.Runtime,
+		Genres:  movie.Genres,
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	var doc any
+	err = json.Unmarshal(current, &doc)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	switch mediaType {
+	case "application/merge-patch+json":
+		var patch any
+
+		err = app.readJSON(w, r, &patch)
+		if err != nil {
+			app.badRequestResponse(w, r, err.Error())
+			return false
+		}
+
+		doc = jsonpatch.MergePatch(doc, patch)
+	default:
+		var ops []jsonpatch.Operation
+
+		err = app.readJSON(w, r, &ops)
+		if err != nil {
+			app.badRequestResponse(w, r, err.Error())
+			return false
+		}
+
+		doc, err = jsonpatch.Apply(doc, ops)
+		if err != nil {
+			switch {
+			case errors.Is(err, jsonpatch.ErrTestFailed):
+				app.errorResponse(w, r, http.StatusConflict, err.Error())
+			default:
+				app.errorResponse(w, r, http.StatusUnprocessableEntity, err.Error())
+			}
+			return false
+		}
+	}
+
+	patched, err := json.Marshal(doc)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	// Fields removed by the patch are left empty, and reported by the validation.
+	var snapshot data.MovieSnapshot
+
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(&snapshot)
+	if err != nil {
+		var unmarshalTypeError *json.UnmarshalTypeError
+
+		switch {
+		case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+			err = fmt.Errorf("patched movie contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+		case errors.As(err, &unmarshalTypeError):
+			err = errors.New("patched movie must be a JSON object")
+		case errors.Is(err, data.ErrInvalidRuntimeFormat):
+			err = errors.New(`patched movie runtime must be a number of minutes, e.g. 102, "102 mins", "1h 42m" or "PT1H42M"`)
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			err = fmt.Errorf("patched movie contains unknown key %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+		}
+
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, err.Error())
+		return false
+	}
+
+	movie.Title = snapshot.Title
+	movie.Year = snapshot.Year
+	movie.Runtime = snapshot.Runtime
+	movie.Genres = snapshot.Genres
+
+	return true
+}
+
 // @Summary      Delete movie
-// @Description  delete a movie record
+// @Description  move a movie record to the trash, it can be restored until it is purged
 // @Param id path int true "id"
+// @Param If-Match header string false "ETag of the version being changed"
 // @Security Bearer
 // @Tags         Movies
 // @Accept 		 json
 // @Produce      json
 // @Success      200  {object} MovieResponse
 // @Failure      404  {object} Error
+// @Failure      412  {object} Error
+// @Failure      428  {object} Error
 // @Failure      500  {object} Error
 // @Router       /movies/{id} [delete]
 func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Request) {
@@ -275,9 +724,32 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Movies.Delete(id)
+	// Deleting is conditional on If-Match like the other writes. The delete then only
+	// happens if the movie is still at the matched version.
+	var version int32
+	if r.Header.Get("If-Match") != "" || app.config.conditional.requireIfMatch {
+		movie, err := app.models.Movies.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if !app.checkIfMatch(w, r, versionETag(movie.Version)) {
+			return
+		}
+		version = movie.Version
+	}
+
+	err = app.models.Movies.Delete(id, version, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrConflictEdit):
+			app.preconditionFailedResponse(w, r)
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
 		default:
@@ -291,3 +763,216 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// @Summary      List deleted movies
+// @Description  show list movies in the trash, page = 1, page_size=10 by default, most recently deleted first.
+// @Param page query int false "page"
+// @Param page_size query int false "page_size"
+// @Param sort query string false "sort"
+// @Security Bearer
+// @Tags         Movies
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} ListMovies
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/trash [get]
+func (app *application) listDeletedMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validation.New()
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 10, v)
+	input.Sort = app.readString(qs, "sort", "-deleted_at")
+	input.SortSafeList = []string{"id", "title", "deleted_at", "-id", "-title", "-deleted_at"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, metadata, err := app.models.Movies.GetAllDeleted(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"metadata": metadata, "movies": movies}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Restore movie
+// @Description  take a deleted movie out of the trash
+// @Param id path int true "id"
+// @Param If-Match header string false "ETag of the movie version being changed"
+// @Security Bearer
+// @Tags         Movies
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} MovieResponse
+// @Failure      404  {object} Error
+// @Failure      412  {object} Error
+// @Failure      428  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/{id}/restore [post]
+func (app *application) restoreMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Restoring is conditional on If-Match like deleting, against the version in the trash
+	var version int32
+	if r.Header.Get("If-Match") != "" || app.config.conditional.requireIfMatch {
+		movie, err := app.models.Movies.GetDeleted(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if !app.checkIfMatch(w, r, versionETag(movie.Version)) {
+			return
+		}
+		version = movie.Version
+	}
+
+	movie, err := app.models.Movies.Restore(id, version, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrConflictEdit):
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", versionETag(movie.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Purge deleted movies
+// @Description  permanently delete the movies which have been in the trash for longer than the retention period
+// @Security Bearer
+// @Tags         Movies
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} MessageResponse
+// @Failure      500  {object} Error
+// @Router       /movies/trash [delete]
+func (app *application) purgeMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	ids, err := app.models.Movies.Purge(app.config.trash.retention)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The images of the purged movies are no longer referenced
+	for _, id := range ids {
+		err = app.storage.DeleteAll(fmt.Sprintf("movies/%d", id))
+		if err != nil {
+			app.logError(r, err)
+		}
+	}
+
+	message := fmt.Sprintf("%d movies deleted more than %s ago successfully purged", len(ids), app.config.trash.retention)
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"message": message, "purged": len(ids)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Merge duplicate movie
+// @Description  fold a duplicate movie into a canonical one: its credits, reviews, watchlist items, watch history and alternate titles are moved to the canonical movie, unless it already has them, and the duplicate is deleted. Its id then redirects to the canonical movie.
+// @Param id path int true "id of the duplicate movie"
+// @Param input body MergeMovieInput true "merge movie payload"
+// @Security Bearer
+// @Tags         Movies
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} MovieResponse
+// @Failure      400  {object} Error
+// @Failure      404  {object} Error
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/{id}/merge [post]
+func (app *application) mergeMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input MergeMovieInput
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err.Error())
+		return
+	}
+
+	v := validation.New()
+
+	v.Check(input.CanonicalID > 0, "canonical_id", "must be provided")
+	v.Check(input.CanonicalID != id, "canonical_id", "must not be the movie being merged")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Movies.Merge(id, input.CanonicalID, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The images of the duplicate are no longer referenced
+	err = app.storage.DeleteAll(fmt.Sprintf("movies/%d", id))
+	if err != nil {
+		app.logError(r, err)
+	}
+
+	movie, err := app.models.Movies.Get(input.CanonicalID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	headers.Set("ETag", versionETag(movie.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/minhnghia2k3/greenlight/internal/data"
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"net/http"
+)
+
+type PersonInput struct {
+	Name      *string `json:"name" example:"Ryan Coogler"`
+	BirthYear *int32  `json:"birth_year" example:"1986"`
+}
+
+type ListPeople struct {
+	Data     data.Person   `json:"data"`
+	Metadata data.Metadata `json:"metadata"`
+}
+
+type PersonResponse struct {
+	Person data.Person `json:"person"`
+}
+
+// @Summary      Create person
+// @Description  handlers receives PersonInput, validate it then create a new person record
+// @Param input body PersonInput true "create person payload"
+// @Tags         People
+// @Accept 		 json
+// @Produce      json
+// @Security Bearer
+// @Success      201  {object} PersonResponse
+// @Failure      400  {object} Error
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /people [post]
+func (app *application) createPersonHandler(w http.ResponseWriter, r *http.Request) {
+	var input PersonInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err.Error())
+		return
+	}
+
+	person := &data.Person{}
+
+	if input.Name != nil {
+		person.Name = *input.Name
+	}
+
+	if input.BirthYear != nil {
+		person.BirthYear = *input.BirthYear
+	}
+
+	v := validation.New()
+
+	if data.ValidatePerson(v, person); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.People.Insert(person)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/people/%d", person.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelop{"person": person}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      List people
+// @Description  show list people, page = 1, page_size=10 by default.
+// @Param page query int false "page"
+// @Param page_size query int false "page_size"
+// @Param name query string false "name"
+// @Param sort query string false "sort"
+// @Security Bearer
+// @Tags         People
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} ListPeople
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /people [get]
+func (app *application) listPeopleHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string
+		data.Filters
+	}
+
+	v := validation.New()
+	qs := r.URL.Query()
+
+	input.Name = app.readString(qs, "name", "")
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 10, v)
+	input.Sort = app.readString(qs, "sort", "id")
+	input.SortSafeList = []string{"id", "name", "birth_year", "-id", "-name", "-birth_year"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	people, metadata, err := app.models.People.GetAll(input.Name, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"metadata": metadata, "people": people}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Get person by id
+// @Description  get person by provided person id
+// @Param id path int true "id"
+// @Tags         People
+// @Accept 		 json
+// @Produce      json
+// @Security Bearer
+// @Success      200  {object} PersonResponse
+// @Failure      404  {object} Error
+// @Failure      500  {object} Error
+// @Router       /people/{id} [get]
+func (app *application) showPersonHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	person, err := app.models.People.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"person": person}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Update person
+// @Description  update an existing person record
+// @Param id path int true "id"
+// @Param input body PersonInput true "update person payload"
+// @Security Bearer
+// @Tags         People
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} PersonResponse
+// @Failure      400  {object} Error
+// @Failure      404  {object} Error
+// @Failure      409  {object} Error
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /people/{id} [patch]
+func (app *application) updatePersonHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	person, err := app.models.People.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input PersonInput
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err.Error())
+		return
+	}
+
+	if input.Name != nil {
+		person.Name = *input.Name
+	}
+
+	if input.BirthYear != nil {
+		person.BirthYear = *input.BirthYear
+	}
+
+	v := validation.New()
+
+	if data.ValidatePerson(v, person); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.People.Update(person)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrConflictEdit):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"person": person}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Delete person
+// @Description  delete a person record together with all of their credits
+// @Param id path int true "id"
+// @Security Bearer
+// @Tags         People
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} MessageResponse
+// @Failure      404  {object} Error
+// @Failure      500  {object} Error
+// @Router       /people/{id} [delete]
+func (app *application) deletePersonHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.People.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"message": "person successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
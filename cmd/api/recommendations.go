@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"github.com/minhnghia2k3/greenlight/internal/data"
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"net/http"
+)
+
+// @Summary      List similar movies
+// @Description  show the movies most similar to a movie, page = 1, page_size=10 by default, ranked by relevance: genre overlap, closeness in year and title similarity.
+// @Description  with personalized=true the ranking also favours movies similar to those on your watchlist, watched or rated well, and leaves out movies you've already watched or reviewed.
+// @Param id path int true "movie id"
+// @Param personalized query bool false "personalise the ranking for you"
+// @Param page query int false "page"
+// @Param page_size query int false "page_size"
+// @Param sort query string false "sort, relevance by default"
+// @Security Bearer
+// @Tags         Movies
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} ListMovies
+// @Failure      404  {object} Error
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/{id}/similar [get]
+func (app *application) listSimilarMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Personalized bool
+		data.Filters
+	}
+
+	v := validation.New()
+	qs := r.URL.Query()
+
+	input.Personalized = app.readBool(qs, "personalized", false, v)
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 10, v)
+	input.Sort = app.readString(qs, "sort", "relevance")
+	input.SortSafeList = []string{"relevance", "title", "year", "average_rating", "-title", "-year", "-average_rating"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var userID int64
+	if input.Personalized {
+		userID = app.contextGetUser(r).ID
+	}
+
+	movies, metadata, err := app.models.Recommendations.Similar(id, userID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"metadata": metadata, "movies": movies}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
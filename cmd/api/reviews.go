@@ -0,0 +1,317 @@
+package main
+
+import (
+	"errors"
+	"github.com/minhnghia2k3/greenlight/internal/data"
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"net/http"
+)
+
+type ReviewInput struct {
+	Rating *int32  `json:"rating" example:"8"`
+	Body   *string `json:"body" example:"A bold and thrilling superhero movie."`
+}
+
+type ListReviews struct {
+	Data     data.Review   `json:"data"`
+	Metadata data.Metadata `json:"metadata"`
+}
+
+type ReviewResponse struct {
+	Review data.Review `json:"review"`
+}
+
+// @Summary      List movie reviews
+// @Description  show list reviews of a movie, page = 1, page_size=10 by default.
+// @Param id path int true "movie id"
+// @Param page query int false "page"
+// @Param page_size query int false "page_size"
+// @Param sort query string false "sort"
+// @Security Bearer
+// @Tags         Reviews
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} ListReviews
+// @Failure      404  {object} Error
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/{id}/reviews [get]
+func (app *application) listMovieReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	v := validation.New()
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 10, v)
+	input.Sort = app.readString(qs, "sort", "-created_at")
+	input.SortSafeList = []string{"id", "created_at", "rating", "-id", "-created_at", "-rating"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Make sure the movie exists, so an unknown movie isn't reported as having no reviews
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	reviews, metadata, err := app.models.Reviews.GetAllForMovie(id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"metadata": metadata, "reviews": reviews}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Review a movie
+// @Description  rate a movie from 1 to 10 with an optional text review, a user can review each movie once
+// @Param id path int true "movie id"
+// @Param input body ReviewInput true "create review payload"
+// @Param If-Match header string false "ETag of the movie version being changed"
+// @Security Bearer
+// @Tags         Reviews
+// @Accept 		 json
+// @Produce      json
+// @Success      201  {object} ReviewResponse
+// @Failure      400  {object} Error
+// @Failure      404  {object} Error
+// @Failure      412  {object} Error
+// @Failure      422  {object} Error
+// @Failure      428  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/{id}/reviews [post]
+func (app *application) createMovieReviewHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.checkIfMatch(w, r, versionETag(movie.Version)) {
+		return
+	}
+
+	var input ReviewInput
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err.Error())
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	review := &data.Review{
+		MovieID:  movie.ID,
+		UserID:   user.ID,
+		UserName: user.Name,
+	}
+
+	if input.Rating != nil {
+		review.Rating = *input.Rating
+	}
+
+	if input.Body != nil {
+		review.Body = *input.Body
+	}
+
+	v := validation.New()
+
+	if data.ValidateReview(v, review); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Reviews.Insert(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateReview):
+			v.AddError("movie_id", "you have already reviewed this movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelop{"review": review}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Update movie review
+// @Description  update the rating or text of your own review
+// @Param id path int true "movie id"
+// @Param review_id path int true "review id"
+// @Param input body ReviewInput true "update review payload"
+// @Param If-Match header string false "ETag of the movie version being changed"
+// @Security Bearer
+// @Tags         Reviews
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} ReviewResponse
+// @Failure      400  {object} Error
+// @Failure      403  {object} Error
+// @Failure      404  {object} Error
+// @Failure      409  {object} Error
+// @Failure      412  {object} Error
+// @Failure      422  {object} Error
+// @Failure      428  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/{id}/reviews/{review_id} [patch]
+func (app *application) updateMovieReviewHandler(w http.ResponseWriter, r *http.Request) {
+	review, ok := app.readOwnReview(w, r)
+	if !ok || !app.checkMovieIfMatch(w, r, review.MovieID) {
+		return
+	}
+
+	var input ReviewInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err.Error())
+		return
+	}
+
+	if input.Rating != nil {
+		review.Rating = *input.Rating
+	}
+
+	if input.Body != nil {
+		review.Body = *input.Body
+	}
+
+	v := validation.New()
+
+	if data.ValidateReview(v, review); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Reviews.Update(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrConflictEdit):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"review": review}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Delete movie review
+// @Description  delete your own review of a movie
+// @Param id path int true "movie id"
+// @Param review_id path int true "review id"
+// @Param If-Match header string false "ETag of the movie version being changed"
+// @Security Bearer
+// @Tags         Reviews
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} MessageResponse
+// @Failure      403  {object} Error
+// @Failure      404  {object} Error
+// @Failure      412  {object} Error
+// @Failure      428  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/{id}/reviews/{review_id} [delete]
+func (app *application) deleteMovieReviewHandler(w http.ResponseWriter, r *http.Request) {
+	review, ok := app.readOwnReview(w, r)
+	if !ok || !app.checkMovieIfMatch(w, r, review.MovieID) {
+		return
+	}
+
+	err := app.models.Reviews.Delete(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"message": "review successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readOwnReview looks up the review addressed by the id and review_id parameters and
+// checks that it was written by the current user. When it returns false an error
+// response has already been sent.
+func (app *application) readOwnReview(w http.ResponseWriter, r *http.Request) (*data.Review, bool) {
+	movieID, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	reviewID, err := app.readInt64Param(r, "review_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	review, err := app.models.Reviews.Get(reviewID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if review.MovieID != movieID {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	if review.UserID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return review, true
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/minhnghia2k3/greenlight/internal/data"
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"math"
+	"net/http"
+)
+
+type RevertInput struct {
+	Version int32 `json:"version" example:"1"`
+}
+
+type ListRevisions struct {
+	Data     data.Revision `json:"data"`
+	Metadata data.Metadata `json:"metadata"`
+}
+
+type RevisionResponse struct {
+	Revision data.Revision `json:"revision"`
+}
+
+// @Summary      List movie revisions
+// @Description  show the change history of a movie, page = 1, page_size=10 by default, newest first.
+// @Param id path int true "movie id"
+// @Param page query int false "page"
+// @Param page_size query int false "page_size"
+// @Param sort query string false "sort"
+// @Security Bearer
+// @Tags         Revisions
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} ListRevisions
+// @Failure      404  {object} Error
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/{id}/revisions [get]
+func (app *application) listMovieRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	v := validation.New()
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 10, v)
+	input.Sort = app.readString(qs, "sort", "-version")
+	input.SortSafeList = []string{"version", "-version"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Make sure the movie exists, so an unknown movie isn't reported as having no history
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	revisions, metadata, err := app.models.Revisions.GetAll(id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"metadata": metadata, "revisions": revisions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Show movie revision
+// @Description  show the state of a movie at a version and what changed from the previous version
+// @Param id path int true "movie id"
+// @Param version path int true "version"
+// @Security Bearer
+// @Tags         Revisions
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} RevisionResponse
+// @Failure      404  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/{id}/revisions/{version} [get]
+func (app *application) showMovieRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	version, err := app.readInt64Param(r, "version")
+	if err != nil || version > math.MaxInt32 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	revision, err := app.models.Revisions.Get(id, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"revision": revision}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Revert movie
+// @Description  set a movie back to the state it had at an earlier version, the revert is recorded as a new version
+// @Param id path int true "movie id"
+// @Param input body RevertInput true "revert payload"
+// @Param If-Match header string false "ETag of the version being changed"
+// @Security Bearer
+// @Tags         Revisions
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} MovieResponse
+// @Failure      400  {object} Error
+// @Failure      404  {object} Error
+// @Failure      409  {object} Error
+// @Failure      412  {object} Error
+// @Failure      422  {object} Error
+// @Failure      428  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/{id}/revert [post]
+func (app *application) revertMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.checkIfMatch(w, r, versionETag(movie.Version)) {
+		return
+	}
+
+	var input RevertInput
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err.Error())
+		return
+	}
+
+	v := validation.New()
+
+	v.Check(input.Version > 0, "version", "must be provided")
+	v.Check(input.Version < movie.Version, "version", "must be an earlier version")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	revision, err := app.models.Revisions.Get(id, input.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("version", "no matching revision found")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Revisions from before the genre vocabulary may use other spellings, or genres which
+	// have since been deleted
+	genres, err := app.models.Genres.Vocabulary()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for i, genre := range revision.Snapshot.Genres {
+		slug, ok := genres.Resolve(genre)
+		if !ok {
+			v.AddError("version", fmt.Sprintf("has the genre %q which is no longer known", genre))
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		revision.Snapshot.Genres[i] = slug
+	}
+
+	err = app.models.Movies.Revert(movie, revision, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrConflictEdit) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrConflictEdit):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", versionETag(movie.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"movies": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -17,18 +17,65 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movie:read", app.listMoviesHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movie:read", app.showMovieHandler))
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movie:write", app.createMovieHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movie:write", app.idempotent(app.createMovieHandler)))
 	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movie:write", app.updateMovieHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movie:write", app.deleteMovieHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/restore", app.requirePermission("movie:write", app.restoreMovieHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions", app.requirePermission("movie:read", app.listMovieRevisionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions/:version", app.requirePermission("movie:read", app.showMovieRevisionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/merge", app.requirePermission("movie:admin", app.mergeMovieHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/revert", app.requirePermission("movie:write", app.revertMovieHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/poster", app.requirePermission("movie:write", app.uploadMoviePosterHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/backdrop", app.requirePermission("movie:write", app.uploadMovieBackdropHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/credits", app.requirePermission("movie:write", app.createMovieCreditHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/credits/:person_id", app.requirePermission("movie:write", app.deleteMovieCreditHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/similar", app.requirePermission("movie:read", app.listSimilarMoviesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/titles", app.requirePermission("movie:read", app.listMovieTitlesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/titles/:locale", app.requirePermission("movie:write", app.putMovieTitleHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/titles/:locale", app.requirePermission("movie:write", app.deleteMovieTitleHandler))
 
-	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
+	// Images are public, so that they can be loaded by <img> tags which can't send a token
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/poster", app.showMoviePosterHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/backdrop", app.showMovieBackdropHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews", app.requirePermission("movie:read", app.listMovieReviewsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/reviews", app.requireActivatedUser(app.createMovieReviewHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id/reviews/:review_id", app.requireActivatedUser(app.updateMovieReviewHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/reviews/:review_id", app.requireActivatedUser(app.deleteMovieReviewHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/people", app.requirePermission("movie:read", app.listPeopleHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/people/:id", app.requirePermission("movie:read", app.showPersonHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/people", app.requirePermission("movie:write", app.createPersonHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/people/:id", app.requirePermission("movie:write", app.updatePersonHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/people/:id", app.requirePermission("movie:write", app.deletePersonHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/genres", app.requirePermission("movie:read", app.listGenresHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/genres/:slug", app.requirePermission("movie:read", app.showGenreHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/genres", app.requirePermission("movie:admin", app.createGenreHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/genres/:slug", app.requirePermission("movie:admin", app.updateGenreHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/genres/:slug", app.requirePermission("movie:admin", app.deleteGenreHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/users", app.idempotent(app.registerUserHandler))
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activeUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
 
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/watchlist", app.requireActivatedUser(app.listWatchlistHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/watchlist", app.requireActivatedUser(app.addWatchlistItemHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me/watchlist/:movie_id", app.requireActivatedUser(app.moveWatchlistItemHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/watchlist/:movie_id", app.requireActivatedUser(app.removeWatchlistItemHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/watched", app.requireActivatedUser(app.listWatchedHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/watched", app.requireActivatedUser(app.createWatchedEntryHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/watched/:id", app.requireActivatedUser(app.deleteWatchedEntryHandler))
+
 	// Authentication
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.idempotentSecret(app.createAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication", app.requireAuthenticatedUser(app.deleteAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", app.idempotentSecret(app.refreshAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.idempotent(app.createPasswordResetTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.idempotent(app.createActivationTokenHandler))
+
+	// Public keys of the JWT signing keys, for other services to check tokens with
+	router.HandlerFunc(http.MethodGet, "/.well-known/jwks.json", app.showJWKSHandler)
 
 	// Metric
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
@@ -36,6 +83,29 @@ func (app *application) routes() http.Handler {
 	// Documenting
 	router.Handler(http.MethodGet, "/swagger/*docs", httpSwagger.WrapHandler)
 
+	// httprouter doesn't allow a static segment where a named parameter is already registered
+	// (/v1/movies/suggest next to /v1/movies/:id), so those routes live on their own router
+	static := httprouter.New()
+	static.HandlerFunc(http.MethodGet, "/v1/movies/suggest", app.requirePermission("movie:read", app.suggestMoviesHandler))
+	static.HandlerFunc(http.MethodGet, "/v1/movies/trash", app.requirePermission("movie:write", app.listDeletedMoviesHandler))
+	static.HandlerFunc(http.MethodDelete, "/v1/movies/trash", app.requirePermission("movie:admin", app.purgeMoviesHandler))
+	static.HandlerFunc(http.MethodGet, "/v1/movies/export", app.requirePermission("movie:read", app.exportMoviesHandler))
+	static.HandlerFunc(http.MethodPost, "/v1/movies/imports", app.requirePermission("movie:write", app.createMovieImportHandler))
+	static.HandlerFunc(http.MethodGet, "/v1/movies/imports/:id", app.requirePermission("movie:write", app.showMovieImportHandler))
+
 	// Wrap the router with the panic recovery middleware
-	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router)))))
+	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(app.staticFirst(static, router))))))
+}
+
+// staticFirst serves a request from the static router when it has a route for the method
+// and path, and from the main router otherwise.
+func (app *application) staticFirst(static *httprouter.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handle, _, _ := static.Lookup(r.Method, r.URL.Path); handle != nil {
+			static.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
 }
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -28,6 +29,46 @@ func (app *application) serve() error {
 	// shutdownError channel will receive any errors returned by the Shutdown() function
 	shutdownError := make(chan error)
 
+	// stop channel is closed on shutdown, to end the periodic background tasks
+	stop := make(chan struct{})
+
+	// Expire idempotency keys in the background rather than while serving requests
+	app.background(func() {
+		ticker := time.NewTicker(10 * time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				err := app.models.Idempotency.DeleteExpired(app.config.idempotency.ttl)
+				if err != nil {
+					app.logger.PrintError(err, nil)
+				}
+			case <-stop:
+				return
+			}
+		}
+	})
+
+	// Reload the JWT signing keys on SIGHUP, to rotate them without a restart
+	go func() {
+		reload := make(chan os.Signal, 1)
+		signal.Notify(reload, syscall.SIGHUP)
+
+		for range reload {
+			err := app.keys.Reload()
+			if err != nil {
+				app.logger.PrintError(err, nil)
+				continue
+			}
+
+			app.logger.PrintInfo("reloaded jwt signing keys", map[string]string{
+				"active_key": app.keys.Active().ID,
+				"keys":       strconv.Itoa(app.keys.Len()),
+			})
+		}
+	}()
+
 	// Start a background goroutine for listening signals.
 	go func() {
 		// quit channel which carries os.Signal values
@@ -57,6 +98,7 @@ func (app *application) serve() error {
 		})
 
 		// Wait until WaitGroup done, return nil error to indicate that shutdown completed without any issues.
+		close(stop)
 		app.wg.Wait()
 		shutdownError <- nil
 	}()
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"github.com/minhnghia2k3/greenlight/internal/data"
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"net/http"
+)
+
+type TitleInput struct {
+	Title string `json:"title" example:"Panthère noire"`
+}
+
+type ListTitles struct {
+	Data data.Title `json:"data"`
+}
+
+type TitleResponse struct {
+	Title data.Title `json:"title"`
+}
+
+// @Summary      List movie titles
+// @Description  show the alternate titles of a movie, ordered by locale
+// @Param id path int true "movie id"
+// @Tags         Movies
+// @Accept 		 json
+// @Produce      json
+// @Security Bearer
+// @Success      200  {object} ListTitles
+// @Failure      404  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/{id}/titles [get]
+func (app *application) listMovieTitlesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	titles, err := app.models.Titles.GetForMovie(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"titles": titles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Set movie title
+// @Description  set the title of a movie in a locale, such as fr or pt-BR, replacing any previous one
+// @Param id path int true "movie id"
+// @Param locale path string true "locale"
+// @Param input body TitleInput true "title payload"
+// @Param If-Match header string false "ETag of the movie version being changed"
+// @Tags         Movies
+// @Accept 		 json
+// @Produce      json
+// @Security Bearer
+// @Success      200  {object} TitleResponse
+// @Failure      400  {object} Error
+// @Failure      404  {object} Error
+// @Failure      412  {object} Error
+// @Failure      422  {object} Error
+// @Failure      428  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/{id}/titles/{locale} [put]
+func (app *application) putMovieTitleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.checkIfMatch(w, r, versionETag(movie.Version)) {
+		return
+	}
+
+	var input TitleInput
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err.Error())
+		return
+	}
+
+	title := &data.Title{
+		MovieID: movie.ID,
+		Locale:  data.NormalizeLocale(httprouter.ParamsFromContext(r.Context()).ByName("locale")),
+		Title:   input.Title,
+	}
+
+	v := validation.New()
+
+	if data.ValidateTitle(v, title); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Titles.Upsert(title)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"title": title}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Remove movie title
+// @Description  remove the title of a movie in a locale
+// @Param id path int true "movie id"
+// @Param locale path string true "locale"
+// @Param If-Match header string false "ETag of the movie version being changed"
+// @Tags         Movies
+// @Accept 		 json
+// @Produce      json
+// @Security Bearer
+// @Success      200  {object} MessageResponse
+// @Failure      404  {object} Error
+// @Failure      412  {object} Error
+// @Failure      428  {object} Error
+// @Failure      500  {object} Error
+// @Router       /movies/{id}/titles/{locale} [delete]
+func (app *application) deleteMovieTitleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if !app.checkMovieIfMatch(w, r, id) {
+		return
+	}
+
+	locale := data.NormalizeLocale(httprouter.ParamsFromContext(r.Context()).ByName("locale"))
+
+	err = app.models.Titles.Delete(id, locale)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"message": "title successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
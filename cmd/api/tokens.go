@@ -1,8 +1,11 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"github.com/minhnghia2k3/greenlight/internal/data"
+	"github.com/minhnghia2k3/greenlight/internal/jwtkeys"
 	"github.com/minhnghia2k3/greenlight/internal/validation"
 	"github.com/pascaldekloe/jwt"
 	"net/http"
@@ -24,7 +27,12 @@ type CreateActivationInput struct {
 }
 
 type TokenResponse struct {
-	AuthenticationToken string `json:"authentication_token"`
+	AuthenticationToken string     `json:"authentication_token"`
+	RefreshToken        data.Token `json:"refresh_token"`
+}
+
+type JWKSResponse struct {
+	Keys []jwtkeys.JWK `json:"keys"`
 }
 
 type ResetTokenResponse struct {
@@ -32,14 +40,16 @@ type ResetTokenResponse struct {
 }
 
 // @Summary      Create authentication token
-// @Description  login account by email and password
+// @Description  login account by email and password. The authentication token is a short-lived JWT, the refresh token exchanges for new tokens at /tokens/refresh.
 // @Tags         Authentications
 // @Accept 		 json
 // @Produce      json
 // @Param		 input 	body 	LoginInput	true	"Login parameters"
+// @Param Idempotency-Key header string false "unique key of the request, retries with the same key are refused as the tokens aren't stored"
 // @Success      201  {object} TokenResponse
 // @Failure      400  {object} Error
 // @Failure      401  {object} Error
+// @Failure      409  {object} Error
 // @Failure      422  {object} Error
 // @Failure      500  {object} Error
 // @Router       /tokens/authentication [post]
@@ -102,24 +112,183 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		}
 	*/
 
+	jwtBytes, err := app.signAccessToken(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// A sign-in starts a new family of refresh tokens
+	refreshToken, err := app.models.Tokens.NewRefresh(user.ID, app.config.jwt.refreshTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Convert the []byte slice to a string and return it in a JSON response
+	err = app.writeJSON(w, http.StatusCreated, envelop{"authentication_token": string(jwtBytes), "refresh_token": refreshToken}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// signAccessToken returns a short-lived JWT authenticating the user. Its random jti claim
+// identifies it, to revoke it on logout.
+func (app *application) signAccessToken(userID int64) ([]byte, error) {
+	jti := make([]byte, 16)
+
+	_, err := rand.Read(jti)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create a JWT claims struct
 	var claims jwt.Claims
-	claims.Subject = strconv.FormatInt(user.ID, 10)
+	claims.ID = hex.EncodeToString(jti)
+	claims.Subject = strconv.FormatInt(userID, 10)
 	claims.Issued = jwt.NewNumericTime(time.Now())
 	claims.NotBefore = jwt.NewNumericTime(time.Now())
-	claims.Expires = jwt.NewNumericTime(time.Now().Add(24 * time.Hour))
+	claims.Expires = jwt.NewNumericTime(time.Now().Add(app.config.jwt.accessTTL))
 	claims.Issuer = app.config.jwt.issuer
 	claims.Audiences = []string{app.config.jwt.issuer}
 
-	// Sign the JWT with HMAC-SHA256 algorithm and the secret key
-	jwtBytes, err := claims.HMACSign(jwt.HS256, []byte(app.config.jwt.secret))
+	// Sign the JWT with the active key, named in its kid header
+	return app.keys.Sign(&claims)
+}
+
+// @Summary      Delete authentication token
+// @Description  logout: revoke the authentication token of the request, and the refresh token given in the body, if any. With all=true every token of your account is revoked, signing you out everywhere.
+// @Tags         Authentications
+// @Accept 		 json
+// @Produce      json
+// @Security Bearer
+// @Param		 input 	body 	TokenInput	false	"refresh token to revoke"
+// @Param all query bool false "revoke every token of your account"
+// @Success      200  {object} MessageResponse
+// @Failure      400  {object} Error
+// @Failure      401  {object} Error
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /tokens/authentication [delete]
+func (app *application) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	claims := app.contextGetClaims(r)
+
+	v := validation.New()
+
+	all := app.readBool(r.URL.Query(), "all", false, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The refresh token of the session is optional, without a body only the
+	// authentication token is revoked
+	var input TokenInput
+
+	if r.ContentLength != 0 {
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err.Error())
+			return
+		}
+
+		if data.ValidateTokenPlainText(v, input.TokenPlainText); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	if all {
+		err := app.models.Tokens.DeleteAllForUser(data.ScopeRefresh, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.models.Revocations.RevokeAllForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusOK, envelop{"message": "you were signed out of every session"}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if input.TokenPlainText != "" {
+		err := app.models.Tokens.DeleteFamily(input.TokenPlainText, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err := app.models.Revocations.Revoke(claims.ID, user.ID, claims.Expires.Time())
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	// Convert the []byte slice to a string and return it in a JSON response
-	err = app.writeJSON(w, http.StatusCreated, envelop{"authentication_token": string(jwtBytes)}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelop{"message": "you were signed out"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Refresh authentication token
+// @Description  exchange a refresh token for a new authentication token and a new refresh token. Each refresh token can only be used once: presenting a used one again revokes every refresh token of its sign-in.
+// @Tags         Authentications
+// @Accept 		 json
+// @Produce      json
+// @Param		 input 	body 	TokenInput	true	"refresh token"
+// @Param Idempotency-Key header string false "unique key of the request, retries with the same key are refused as the tokens aren't stored"
+// @Success      201  {object} TokenResponse
+// @Failure      400  {object} Error
+// @Failure      401  {object} Error
+// @Failure      409  {object} Error
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /tokens/refresh [post]
+func (app *application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input TokenInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err.Error())
+		return
+	}
+
+	v := validation.New()
+
+	if data.ValidateTokenPlainText(v, input.TokenPlainText); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	refreshToken, err := app.models.Tokens.Rotate(input.TokenPlainText, app.config.jwt.refreshTTL)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, r, http.StatusUnauthorized, "invalid or expired refresh token")
+		case errors.Is(err, data.ErrRefreshTokenReused):
+			app.errorResponse(w, r, http.StatusUnauthorized, "refresh token was already used, sign in again")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	jwtBytes, err := app.signAccessToken(refreshToken.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelop{"authentication_token": string(jwtBytes), "refresh_token": refreshToken}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -129,11 +298,13 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 // @Summary      Request a token for reset password
 // @Description  request a token for reset password, must provide *valid* and *activated* email address
 // @Param   input      body ResetPasswordInput true "Reset password input"
+// @Param Idempotency-Key header string false "unique key of the request, retries with the same key replay the first response"
 // @Tags         Authentications
 // @Accept 		 json
 // @Produce      json
 // @Success      202  {object} ResetTokenResponse
 // @Failure      400  {object} Error
+// @Failure      409  {object} Error
 // @Failure      422  {object} Error
 // @Failure      500  {object} Error
 // @Router       /tokens/password-reset [post]
@@ -208,11 +379,13 @@ func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r
 // @Description  receive an email address, check user's activation status,
 // then generate and send activation within 3 days expiration to user
 // @Param		 input      body CreateActivationInput true "Create activation input"
+// @Param Idempotency-Key header string false "unique key of the request, retries with the same key replay the first response"
 // @Tags         Authentications
 // @Accept 		 json
 // @Produce      json
 // @Success      202  {object} ResetTokenResponse
 // @Failure      400  {object} Error
+// @Failure      409  {object} Error
 // @Failure      422  {object} Error
 // @Failure      500  {object} Error
 // @Router       /tokens/activation [post]
@@ -279,3 +452,24 @@ func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *h
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// showJWKSHandler serves the public keys access tokens are signed with as a JSON Web Key
+// Set, so that other services can check Greenlight tokens. Tokens name their key in the kid
+// header. HMAC keys are secret and never listed.
+// @Summary      Show token signing keys
+// @Description  list the public keys access tokens are signed with, as a JSON Web Key Set. Tokens name their key in the kid header. Served at /.well-known/jwks.json, outside the /v1 base path.
+// @Tags         Authentications
+// @Produce      json
+// @Success      200  {object} JWKSResponse
+// @Failure      500  {object} Error
+// @Router       /.well-known/jwks.json [get]
+func (app *application) showJWKSHandler(w http.ResponseWriter, r *http.Request) {
+	// Let verifiers cache the keys for a while, new keys are published before they sign
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "public, max-age=300")
+
+	err := app.writeJSON(w, http.StatusOK, envelop{"keys": app.keys.JWKS()}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
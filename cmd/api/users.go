@@ -32,11 +32,13 @@ type UpdateUserInput struct {
 // @Summary      Register account
 // @Description  register user account
 // @Param input body RegisterUserInput true "register user input"
+// @Param Idempotency-Key header string false "unique key of the request, retries with the same key replay the first response"
 // @Tags         Users
 // @Accept 		 json
 // @Produce      json
 // @Success      201  {object} UserResponse
 // @Failure      400  {object} Error
+// @Failure      409  {object} Error
 // @Failure      422  {object} Error
 // @Failure      500  {object} Error
 // @Router       /users [post]
@@ -265,6 +267,19 @@ func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http
 		return
 	}
 
+	// Sign the user out of every session started with the old password
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeRefresh, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Revocations.RevokeAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	// Send user confirm message
 	env := envelop{"message": "your password was successfully reset"}
 
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"errors"
+	"github.com/minhnghia2k3/greenlight/internal/data"
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"net/http"
+	"time"
+)
+
+type WatchlistInput struct {
+	MovieID int64 `json:"movie_id" example:"1"`
+}
+
+type WatchlistPositionInput struct {
+	Position int32 `json:"position" example:"1"`
+}
+
+type WatchedInput struct {
+	MovieID   int64  `json:"movie_id" example:"1"`
+	WatchedAt string `json:"watched_at" example:"2024-08-06"`
+}
+
+type ListWatchlist struct {
+	Data     data.WatchlistItem `json:"data"`
+	Metadata data.Metadata      `json:"metadata"`
+}
+
+type WatchlistItemResponse struct {
+	Item data.WatchlistItem `json:"item"`
+}
+
+type ListWatched struct {
+	Data     data.WatchedEntry `json:"data"`
+	Metadata data.Metadata     `json:"metadata"`
+}
+
+type WatchedEntryResponse struct {
+	Entry data.WatchedEntry `json:"entry"`
+}
+
+// @Summary      List watchlist
+// @Description  show the movies on your watchlist, page = 1, page_size=10 by default, ordered by position.
+// @Param page query int false "page"
+// @Param page_size query int false "page_size"
+// @Param sort query string false "sort"
+// @Security Bearer
+// @Tags         Watchlist
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} ListWatchlist
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /users/me/watchlist [get]
+func (app *application) listWatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validation.New()
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 10, v)
+	input.Sort = app.readString(qs, "sort", "position")
+	input.SortSafeList = []string{"position", "added_at", "title", "year", "-position", "-added_at", "-title", "-year"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	items, metadata, err := app.models.Watchlist.GetAll(user.ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"metadata": metadata, "watchlist": items}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Add movie to watchlist
+// @Description  append a movie to the end of your watchlist
+// @Param input body WatchlistInput true "add watchlist item payload"
+// @Security Bearer
+// @Tags         Watchlist
+// @Accept 		 json
+// @Produce      json
+// @Success      201  {object} WatchlistItemResponse
+// @Failure      400  {object} Error
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /users/me/watchlist [post]
+func (app *application) addWatchlistItemHandler(w http.ResponseWriter, r *http.Request) {
+	var input WatchlistInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err.Error())
+		return
+	}
+
+	v := validation.New()
+
+	movie, ok := app.readMovieInput(w, r, v, input.MovieID)
+	if !ok {
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	item, err := app.models.Watchlist.Add(user.ID, movie)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateWatchlistItem):
+			v.AddError("movie_id", "this movie is already on your watchlist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelop{"item": item}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Reorder watchlist
+// @Description  move a movie to a new position on your watchlist, the movies in between shift by one
+// @Param movie_id path int true "movie id"
+// @Param input body WatchlistPositionInput true "watchlist position payload"
+// @Security Bearer
+// @Tags         Watchlist
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} WatchlistPositionInput
+// @Failure      400  {object} Error
+// @Failure      404  {object} Error
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /users/me/watchlist/{movie_id} [patch]
+func (app *application) moveWatchlistItemHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readInt64Param(r, "movie_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input WatchlistPositionInput
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err.Error())
+		return
+	}
+
+	v := validation.New()
+
+	if v.Check(input.Position > 0, "position", "must be greater than zero"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	position, err := app.models.Watchlist.Move(user.ID, movieID, input.Position)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"position": position}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Remove movie from watchlist
+// @Description  remove a movie from your watchlist
+// @Param movie_id path int true "movie id"
+// @Security Bearer
+// @Tags         Watchlist
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} MessageResponse
+// @Failure      404  {object} Error
+// @Failure      500  {object} Error
+// @Router       /users/me/watchlist/{movie_id} [delete]
+func (app *application) removeWatchlistItemHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readInt64Param(r, "movie_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Watchlist.Remove(user.ID, movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"message": "movie successfully removed from watchlist"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      List watched movies
+// @Description  show your watched history, page = 1, page_size=10 by default, most recently watched first.
+// @Param page query int false "page"
+// @Param page_size query int false "page_size"
+// @Param sort query string false "sort"
+// @Security Bearer
+// @Tags         Watchlist
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} ListWatched
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /users/me/watched [get]
+func (app *application) listWatchedHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validation.New()
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 10, v)
+	input.Sort = app.readString(qs, "sort", "-watched_at")
+	input.SortSafeList = []string{"watched_at", "title", "year", "-watched_at", "-title", "-year"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	entries, metadata, err := app.models.Watched.GetAll(user.ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"metadata": metadata, "watched": entries}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Log a watched movie
+// @Description  record that you watched a movie, watched_at (YYYY-MM-DD) defaults to today
+// @Param input body WatchedInput true "watched movie payload"
+// @Security Bearer
+// @Tags         Watchlist
+// @Accept 		 json
+// @Produce      json
+// @Success      201  {object} WatchedEntryResponse
+// @Failure      400  {object} Error
+// @Failure      422  {object} Error
+// @Failure      500  {object} Error
+// @Router       /users/me/watched [post]
+func (app *application) createWatchedEntryHandler(w http.ResponseWriter, r *http.Request) {
+	var input WatchedInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err.Error())
+		return
+	}
+
+	v := validation.New()
+
+	entry := &data.WatchedEntry{WatchedAt: time.Now().UTC().Truncate(24 * time.Hour)}
+
+	if input.WatchedAt != "" {
+		entry.WatchedAt, err = time.Parse(time.DateOnly, input.WatchedAt)
+		if err != nil {
+			v.AddError("watched_at", "must be a date in YYYY-MM-DD format")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	if data.ValidateWatchedEntry(v, entry); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, ok := app.readMovieInput(w, r, v, input.MovieID)
+	if !ok {
+		return
+	}
+	entry.Movie = movie
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Watched.Insert(user.ID, entry)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelop{"entry": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Delete a watched entry
+// @Description  remove an entry from your watched history
+// @Param id path int true "watched entry id"
+// @Security Bearer
+// @Tags         Watchlist
+// @Accept 		 json
+// @Produce      json
+// @Success      200  {object} MessageResponse
+// @Failure      404  {object} Error
+// @Failure      500  {object} Error
+// @Router       /users/me/watched/{id} [delete]
+func (app *application) deleteWatchedEntryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Watched.Delete(user.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelop{"message": "watched entry successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readMovieInput looks up the movie referenced by a movie_id body field. Unknown movies
+// are reported as a failed validation on movie_id. When it returns false an error
+// response has already been sent.
+func (app *application) readMovieInput(w http.ResponseWriter, r *http.Request, v *validation.Validator, movieID int64) (*data.Movie, bool) {
+	if v.Check(movieID > 0, "movie_id", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, false
+	}
+
+	movie, err := app.models.Movies.Get(movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("movie_id", "no matching movie found")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return movie, true
+}
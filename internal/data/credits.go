@@ -0,0 +1,155 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"time"
+)
+
+const (
+	RoleDirector = "director"
+	RoleActor    = "actor"
+	RoleWriter   = "writer"
+)
+
+var (
+	ErrDuplicateCredit = errors.New("duplicate credit")
+)
+
+// Credit links a person to a movie in a specific role.
+type Credit struct {
+	MovieID      int64  `json:"-"`
+	PersonID     int64  `json:"person_id"`
+	Name         string `json:"name"`
+	Role         string `json:"role"`
+	Character    string `json:"character,omitempty"`
+	BillingOrder int32  `json:"billing_order"`
+}
+
+// CreditModel struct which wrap a sql.DB connection pool
+type CreditModel struct {
+	DB *sql.DB
+}
+
+func ValidateCredit(v *validation.Validator, credit *Credit) {
+	v.Check(credit.PersonID > 0, "person_id", "must be provided")
+	v.Check(validation.PermittedValue(credit.Role, RoleDirector, RoleActor, RoleWriter), "role", "must be one of director, actor or writer")
+	v.Check(credit.Role == RoleActor || credit.Character == "", "character", "must only be provided for actors")
+	v.Check(len(credit.Character) <= 500, "character", "must not be more than 500 bytes long")
+	v.Check(credit.BillingOrder >= 0, "billing_order", "must not be negative")
+}
+
+// Insert adds a credit and bumps the version of the credited movie, so that the ETag of
+// its expanded credits changes.
+func (m *CreditModel) Insert(credit *Credit) error {
+	query := `
+		WITH credit AS (
+			INSERT INTO movie_credits (movie_id, person_id, role, character_name, billing_order)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING movie_id
+		)
+		UPDATE movies SET version = version + 1
+		WHERE id IN (SELECT movie_id FROM credit)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{credit.MovieID, credit.PersonID, credit.Role, credit.Character, credit.BillingOrder}
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "movie_credits_pkey"`:
+			return ErrDuplicateCredit
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetForMovies returns the credits of several movies, keyed by movie ID. The credits of
+// each movie are ordered by role and billing order, joined with the name of each credited
+// person.
+func (m *CreditModel) GetForMovies(movieIDs []int64) (map[int64][]*Credit, error) {
+	query := `
+		SELECT movie_credits.movie_id, movie_credits.person_id, people.name, movie_credits.role,
+		       movie_credits.character_name, movie_credits.billing_order
+		FROM movie_credits
+		INNER JOIN people ON people.id = movie_credits.person_id
+		WHERE movie_credits.movie_id = ANY($1)
+		ORDER BY movie_credits.movie_id, movie_credits.role, movie_credits.billing_order, people.name
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := make(map[int64][]*Credit)
+	for rows.Next() {
+		var credit Credit
+
+		err = rows.Scan(
+			&credit.MovieID,
+			&credit.PersonID,
+			&credit.Name,
+			&credit.Role,
+			&credit.Character,
+			&credit.BillingOrder,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		credits[credit.MovieID] = append(credits[credit.MovieID], &credit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+// Delete removes the credits of a person on a movie. An empty role removes every role
+// the person holds on that movie. The movie version is bumped like on Insert.
+func (m *CreditModel) Delete(movieID, personID int64, role string) error {
+	query := `
+		WITH deleted AS (
+			DELETE FROM movie_credits
+			WHERE movie_id = $1 AND person_id = $2 AND (role = $3 OR $3 = '')
+			RETURNING movie_id
+		)
+		UPDATE movies SET version = version + 1
+		WHERE id IN (SELECT movie_id FROM deleted)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	results, err := m.DB.ExecContext(ctx, query, movieID, personID, role)
+	if err != nil {
+		return err
+	}
+
+	rowAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,248 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"time"
+)
+
+// normalizedTitle is the SQL expression of the form titles are compared in to find
+// duplicates: lower-cased, without spaces or punctuation. It matches the expression of
+// the movies_normalized_title_idx index.
+const normalizedTitle = `lower(regexp_replace(%s, '[^[:alnum:]]+', '', 'g'))`
+
+// duplicateSimilarity is how trigram-similar titles must be for fuzzy duplicate detection.
+const duplicateSimilarity = 0.6
+
+// FindDuplicates returns the movies which are likely duplicates of a movie about to be
+// created: same year and same title, ignoring case, spaces and punctuation. A fuzzy search
+// also returns movies a year apart, or with a similar title.
+func (m *MovieModel) FindDuplicates(movie *Movie, fuzzy bool) ([]*Movie, error) {
+	selectList, targets := selectMovieColumns(movieColumns, Projection{})
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM movies
+		WHERE deleted_at IS NULL
+		AND (
+			year = $2 AND %s = %s
+			OR $3 AND year BETWEEN $2 - 1 AND $2 + 1 AND similarity(title, $1) >= %g
+		)
+		ORDER BY similarity(title, $1) DESC, id ASC
+		LIMIT 10
+	`, selectList, fmt.Sprintf(normalizedTitle, "title"), fmt.Sprintf(normalizedTitle, "$1"), duplicateSimilarity)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movie.Title, movie.Year, fuzzy)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+	for rows.Next() {
+		var movie Movie
+
+		err = rows.Scan(targets(&movie)...)
+		if err != nil {
+			return nil, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
+
+// Merge folds a duplicate movie into a canonical one. The credits, reviews, watchlist
+// items, watch history and alternate titles of the duplicate are moved to the canonical
+// movie, unless it already has them, and the duplicate is deleted. Its id then
+// redirects to the canonical movie, as do the ids of movies merged into it before. The
+// duplicate stays in the table, out of the trash, so its revisions are kept; both movies
+// get a revision recording the merge. ErrRecordNotFound is returned when either movie
+// doesn't exist or is in the trash.
+func (m *MovieModel) Merge(duplicateID, canonicalID, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock both movies, so neither is changed or deleted while the duplicate is merged
+	var found int
+
+	query := `
+		SELECT COUNT(*) FROM (
+			SELECT id FROM movies
+			WHERE id IN ($1, $2) AND deleted_at IS NULL
+			FOR UPDATE
+		) AS locked
+	`
+
+	err = tx.QueryRowContext(ctx, query, duplicateID, canonicalID).Scan(&found)
+	if err != nil {
+		return err
+	}
+
+	if found != 2 {
+		return ErrRecordNotFound
+	}
+
+	// Lock the watchlists the duplicate is on, like every watchlist change does, in user ID
+	// order so that concurrent merges don't deadlock
+	query = `
+		SELECT 1 FROM users
+		WHERE id IN (SELECT user_id FROM watchlist_items WHERE movie_id = $1)
+		ORDER BY id
+		FOR NO KEY UPDATE
+	`
+
+	_, err = tx.ExecContext(ctx, query, duplicateID)
+	if err != nil {
+		return err
+	}
+
+	queries := []string{
+		`INSERT INTO movie_credits (movie_id, person_id, role, character_name, billing_order)
+		 SELECT $2, person_id, role, character_name, billing_order FROM movie_credits WHERE movie_id = $1
+		 ON CONFLICT DO NOTHING`,
+		`UPDATE reviews SET movie_id = $2
+		 WHERE movie_id = $1 AND user_id NOT IN (SELECT user_id FROM reviews WHERE movie_id = $2)`,
+		`UPDATE watchlist_items SET movie_id = $2
+		 WHERE movie_id = $1 AND user_id NOT IN (SELECT user_id FROM watchlist_items WHERE movie_id = $2)`,
+		`UPDATE watched_movies SET movie_id = $2 WHERE movie_id = $1`,
+		`INSERT INTO movie_titles (movie_id, locale, title)
+		 SELECT $2, locale, title FROM movie_titles WHERE movie_id = $1
+		 ON CONFLICT DO NOTHING`,
+		`UPDATE movie_redirects SET movie_id = $2 WHERE movie_id = $1`,
+		`INSERT INTO movie_redirects (old_id, movie_id) VALUES ($1, $2)`,
+	}
+
+	for _, query := range queries {
+		_, err = tx.ExecContext(ctx, query, duplicateID, canonicalID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The reviews and watchlist items left are of users who had the canonical movie
+	// already. The items after a removed watchlist item move up, so positions stay dense.
+	queries = []string{
+		`DELETE FROM reviews WHERE movie_id = $1`,
+		`WITH removed AS (
+			DELETE FROM watchlist_items WHERE movie_id = $1
+			RETURNING user_id, position
+		 )
+		 UPDATE watchlist_items SET position = watchlist_items.position - 1
+		 FROM removed
+		 WHERE watchlist_items.user_id = removed.user_id AND watchlist_items.position > removed.position`,
+	}
+
+	for _, query := range queries {
+		_, err = tx.ExecContext(ctx, query, duplicateID)
+		if err != nil {
+			return err
+		}
+	}
+
+	var duplicate Movie
+
+	// The images of the duplicate are deleted along with the merge
+	query = `
+		UPDATE movies
+		SET deleted_at = NOW(), poster = '', backdrop = '', version = version + 1
+		WHERE id = $1
+		RETURNING id, title, year, runtime, genres, version
+	`
+
+	err = tx.QueryRowContext(ctx, query, duplicateID).Scan(
+		&duplicate.ID,
+		&duplicate.Title,
+		&duplicate.Year,
+		&duplicate.Runtime,
+		pq.Array(&duplicate.Genres),
+		&duplicate.Version,
+	)
+	if err != nil {
+		return err
+	}
+
+	before := snapshotOf(&duplicate)
+	err = insertRevision(ctx, tx, &duplicate, userID, RevisionDelete, &before)
+	if err != nil {
+		return err
+	}
+
+	// refreshMovieRating bumps the version of the canonical movie, which changed with the
+	// credits, reviews and titles it was given
+	err = refreshMovieRating(ctx, tx, canonicalID)
+	if err != nil {
+		return err
+	}
+
+	var canonical Movie
+
+	query = `
+		SELECT id, title, year, runtime, genres, version
+		FROM movies
+		WHERE id = $1
+	`
+
+	err = tx.QueryRowContext(ctx, query, canonicalID).Scan(
+		&canonical.ID,
+		&canonical.Title,
+		&canonical.Year,
+		&canonical.Runtime,
+		pq.Array(&canonical.Genres),
+		&canonical.Version,
+	)
+	if err != nil {
+		return err
+	}
+
+	before = snapshotOf(&canonical)
+	err = insertRevision(ctx, tx, &canonical, userID, RevisionMerge, &before)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Redirect returns the id of the movie a merged movie id redirects to, or
+// ErrRecordNotFound when the id wasn't merged.
+func (m *MovieModel) Redirect(oldID int64) (int64, error) {
+	query := `
+		SELECT movie_id FROM movie_redirects
+		WHERE old_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+
+	err := m.DB.QueryRowContext(ctx, query, oldID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return id, nil
+}
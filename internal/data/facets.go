@@ -0,0 +1,118 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"strings"
+	"time"
+)
+
+// MovieFacets lists the facets which can be counted over a movie listing.
+var MovieFacets = []string{"genres", "decade", "runtime"}
+
+// movieFacetQueries counts the matches of a listing per facet value. Each query returns
+// the facet, the value, the count and the position of the value within the facet: genres
+// are ordered by count, decades and runtime bands by their start.
+var movieFacetQueries = map[string]string{
+	"genres": `
+		SELECT 'genres', genre, COUNT(*), -COUNT(*)
+		FROM matches, unnest(genres) AS genre
+		GROUP BY genre`,
+	"decade": `
+		SELECT 'decade', (year / 10 * 10)::text || 's', COUNT(*), year / 10 * 10
+		FROM matches
+		GROUP BY year / 10 * 10`,
+	"runtime": `
+		SELECT 'runtime', band.label, COUNT(*), band.start
+		FROM matches
+		CROSS JOIN LATERAL (
+			SELECT CASE
+				WHEN runtime < 90 THEN '0-89'
+				WHEN runtime < 120 THEN '90-119'
+				WHEN runtime < 150 THEN '120-149'
+				ELSE '150+'
+			END AS label,
+			CASE
+				WHEN runtime < 90 THEN 0
+				WHEN runtime < 120 THEN 90
+				WHEN runtime < 150 THEN 120
+				ELSE 150
+			END AS start
+		) AS band
+		GROUP BY band.label, band.start`,
+}
+
+// FacetCount is how many movies of a listing have a facet value.
+type FacetCount struct {
+	Value string `json:"value" example:"drama"`
+	Count int    `json:"count" example:"12"`
+}
+
+// Facets holds the counts of each requested facet, keyed by facet name.
+type Facets map[string][]FacetCount
+
+func ValidateFacets(v *validation.Validator, facets []string) {
+	for _, facet := range facets {
+		v.Check(validation.PermittedValue(facet, MovieFacets...), "facets", fmt.Sprintf("invalid facet value %q", facet))
+	}
+}
+
+// Facets counts the movies matching the criteria, the same way as GetAll, per value of each
+// of the requested facets. The counts cover every match, not only a page of them.
+func (m *MovieModel) Facets(criteria MovieCriteria, facets []string) (Facets, error) {
+	result := make(Facets, len(facets))
+
+	parts := make([]string, 0, len(facets))
+	for _, facet := range facets {
+		if _, ok := result[facet]; ok {
+			continue
+		}
+		result[facet] = []FacetCount{}
+		parts = append(parts, movieFacetQueries[facet])
+	}
+
+	if len(parts) == 0 {
+		return result, nil
+	}
+
+	matches, args := movieMatches(criteria)
+
+	query := fmt.Sprintf(`
+	WITH matches AS (
+		SELECT genres, year, runtime
+		%s
+	)
+	%s
+	ORDER BY 1, 4, 2`, matches, strings.Join(parts, "\n\tUNION ALL"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			facet    string
+			count    FacetCount
+			position int
+		)
+
+		err = rows.Scan(&facet, &count.Value, &count.Count, &position)
+		if err != nil {
+			return nil, err
+		}
+
+		result[facet] = append(result[facet], count)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -1,25 +1,53 @@
 package data
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/minhnghia2k3/greenlight/internal/validation"
 	"math"
+	"slices"
 	"strings"
 )
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	Cursor       string `json:"cursor,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
 }
 
+// Filters holds the paging and sorting parameters of a listing. Sort is a comma-separated
+// list of safelisted keys, e.g. "-year,title", applied in order. When Cursor is set the
+// listing is paged by keyset instead of by Page: it continues after the row the cursor
+// was issued for.
 type Filters struct {
 	Page         int
 	PageSize     int
 	Sort         string
 	SortSafeList []string
+	Cursor       string
+}
+
+// cursor is the decoded form of the opaque cursor handed to clients. It records the sort
+// it was issued for and the sort column values and id of the last row of a page.
+type cursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+	ID     int64    `json:"id"`
+}
+
+// maxSortKeys is how many keys a sort may combine.
+const maxSortKeys = 3
+
+// sortKey is one column of a sort, in the order the rows are returned.
+type sortKey struct {
+	column     string
+	descending bool
 }
 
 func ValidateFilters(v *validation.Validator, f Filters) {
@@ -27,7 +55,26 @@ func ValidateFilters(v *validation.Validator, f Filters) {
 	v.Check(f.Page <= 10000000, "page", "must be a maximum of 10 million")
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
-	v.Check(validation.PermittedValue(f.Sort, f.SortSafeList...), "sort", fmt.Sprintf("invalid sort value %q", f.SortSafeList))
+
+	keys := strings.Split(f.Sort, ",")
+	columns := make([]string, len(keys))
+	for i, key := range keys {
+		v.Check(validation.PermittedValue(key, f.SortSafeList...), "sort", fmt.Sprintf("invalid sort value %q", f.SortSafeList))
+		columns[i] = strings.TrimPrefix(key, "-")
+	}
+	v.Check(len(keys) <= maxSortKeys, "sort", fmt.Sprintf("must not combine more than %d keys", maxSortKeys))
+	v.Check(validation.Unique(columns), "sort", "must not sort by the same column twice")
+
+	if f.Cursor != "" {
+		v.Check(f.Page == 1, "cursor", "must not be combined with page")
+
+		c, err := f.decodeCursor()
+		if err != nil {
+			v.AddError("cursor", "invalid cursor")
+			return
+		}
+		v.Check(c.Sort == f.Sort && len(c.Values) == len(keys), "cursor", "must be used with the sort it was issued for")
+	}
 }
 
 // The calcualteMedata() function calculates the pagination metadata
@@ -46,25 +93,56 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 	}
 }
 
-// Check that the client-provided f.Sort field matches one of the entries in our safelist
-// and if it does, extract the column name from the Sort field by stripping the leading
-// hyphen character.
-func (f *Filters) sortColumn() string {
-	for _, safeValue := range f.SortSafeList {
-		if f.Sort == safeValue {
-			// Trim prefix
-			return strings.TrimPrefix(f.Sort, "-")
+// Check that each key of the client-provided f.Sort field matches one of the entries in
+// our safelist and if it does, extract the column name by stripping the leading hyphen
+// character. The direction depends on the hyphen: relevance reads as "most relevant
+// first", so it is the one column sorted in reverse.
+func (f *Filters) sortKeys() []sortKey {
+	var keys []sortKey
+
+	for _, key := range strings.Split(f.Sort, ",") {
+		if !validation.PermittedValue(key, f.SortSafeList...) {
+			// Help prevent SQL injection.
+			panic("unsafe sort parameter: " + f.Sort)
 		}
+
+		column := strings.TrimPrefix(key, "-")
+		keys = append(keys, sortKey{column: column, descending: strings.HasPrefix(key, "-") != (column == "relevance")})
 	}
 
-	// Help prevent SQL injection.
-	panic("unsafe sort parameter: " + f.Sort)
+	return keys
 }
 
-// Return the sort direction ("ASC" OR "DESC") depending on the prefix character of the
-// sort field.
-func (f *Filters) sortDirection() string {
-	if strings.HasPrefix(f.Sort, "-") {
+// sortColumns returns the columns sorted by, in order.
+func (f *Filters) sortColumns() []string {
+	var columns []string
+	for _, key := range f.sortKeys() {
+		columns = append(columns, key.column)
+	}
+	return columns
+}
+
+// SortsBy reports whether the sort includes the given column, in either direction.
+func (f *Filters) SortsBy(column string) bool {
+	return slices.Contains(strings.Split(strings.ReplaceAll(f.Sort, "-", ""), ","), column)
+}
+
+// orderBy returns the ORDER BY list of the sort, e.g. "year DESC, title ASC". A non-empty
+// table qualifies the columns.
+func (f *Filters) orderBy(table string) string {
+	var terms []string
+	for _, key := range f.sortKeys() {
+		column := key.column
+		if table != "" {
+			column = table + "." + column
+		}
+		terms = append(terms, column+" "+key.direction())
+	}
+	return strings.Join(terms, ", ")
+}
+
+func (k sortKey) direction() string {
+	if k.descending {
 		return "DESC"
 	}
 	return "ASC"
@@ -75,7 +153,90 @@ func (f Filters) limit() int {
 }
 
 func (f Filters) offset() int {
+	// Keyset pages never skip rows, the cursor condition does it
+	if f.Cursor != "" {
+		return 0
+	}
+
 	// page_size=5&page=3
 	// limit = 5, offset = 10.
 	return (f.Page - 1) * f.PageSize
 }
+
+// encodeCursor returns the opaque cursor continuing after a row with the given sort
+// column values and id.
+func (f Filters) encodeCursor(values []string, id int64) string {
+	js, _ := json.Marshal(cursor{Sort: f.Sort, Values: values, ID: id})
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func (f Filters) decodeCursor() (cursor, error) {
+	var c cursor
+
+	js, err := base64.RawURLEncoding.DecodeString(f.Cursor)
+	if err != nil {
+		return c, err
+	}
+
+	err = json.Unmarshal(js, &c)
+	return c, err
+}
+
+// keysetCondition returns the WHERE condition selecting the rows after the cursor in
+// "ORDER BY <sort>, id ASC" order, together with its arguments. The arguments are
+// numbered from the given placeholder onwards.
+//
+// A row comes after the cursor when it is past the cursor on the first sort key, or ties
+// on it and is past the cursor on the next key, and so on with the id breaking the last
+// tie. Keys can sort in different directions, so a row comparison can't be used.
+func (f Filters) keysetCondition(placeholder int) (string, []any, error) {
+	c, err := f.decodeCursor()
+	if err != nil {
+		return "", nil, err
+	}
+
+	keys := f.sortKeys()
+	if len(c.Values) != len(keys) {
+		return "", nil, errors.New("cursor doesn't match the sort")
+	}
+
+	var args []any
+	for i, key := range keys {
+		if key.column == "id" {
+			args = append(args, c.ID)
+		} else {
+			args = append(args, c.Values[i])
+		}
+	}
+
+	// Sorting by id already makes the order unique
+	if !slices.ContainsFunc(keys, func(k sortKey) bool { return k.column == "id" }) {
+		keys = append(keys, sortKey{column: "id"})
+		args = append(args, c.ID)
+	}
+
+	var terms []string
+	for i, key := range keys {
+		var conditions []string
+		for j := range i {
+			conditions = append(conditions, fmt.Sprintf("%s = $%d", keys[j].column, placeholder+j))
+		}
+
+		operator := ">"
+		if key.descending {
+			operator = "<"
+		}
+		conditions = append(conditions, fmt.Sprintf("%s %s $%d", key.column, operator, placeholder+i))
+
+		if len(conditions) > 1 {
+			terms = append(terms, "("+strings.Join(conditions, " AND ")+")")
+		} else {
+			terms = append(terms, conditions[0])
+		}
+	}
+
+	if len(terms) == 1 {
+		return terms[0], args, nil
+	}
+	return "(" + strings.Join(terms, " OR ") + ")", args, nil
+}
@@ -0,0 +1,165 @@
+package data
+
+import (
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"strings"
+	"testing"
+)
+
+func TestKeysetCondition(t *testing.T) {
+	tests := []struct {
+		sort      string
+		condition string
+		args      int
+	}{
+		{"id", "id > $4", 1},
+		{"-id", "id < $4", 1},
+		{"year", "(year > $4 OR (year = $4 AND id > $5))", 2},
+		{"-title", "(title < $4 OR (title = $4 AND id > $5))", 2},
+		{"relevance", "(relevance < $4 OR (relevance = $4 AND id > $5))", 2},
+		{"-year,title", "(year < $4 OR (year = $4 AND title > $5) OR (year = $4 AND title = $5 AND id > $6))", 3},
+		{"title,-id", "(title > $4 OR (title = $4 AND id < $5))", 2},
+	}
+
+	for _, tt := range tests {
+		f := Filters{Sort: tt.sort, SortSafeList: []string{"id", "-id", "year", "-year", "title", "-title", "relevance"}}
+		values := make([]string, len(f.sortKeys()))
+		for i := range values {
+			values[i] = "1999"
+		}
+		f.Cursor = f.encodeCursor(values, 42)
+
+		condition, args, err := f.keysetCondition(4)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.sort, err)
+		}
+		if condition != tt.condition {
+			t.Errorf("%s: got condition %q, want %q", tt.sort, condition, tt.condition)
+		}
+		if len(args) != tt.args || args[len(args)-1] != int64(42) {
+			t.Errorf("%s: got args %v", tt.sort, args)
+		}
+	}
+}
+
+func TestValidateFiltersSort(t *testing.T) {
+	tests := []struct {
+		sort  string
+		valid bool
+	}{
+		{"year", true},
+		{"-year,title", true},
+		{"-year,title,id", true},
+		{"-year,title,id,runtime", false},
+		{"year,-year", false},
+		{"year,", false},
+		{"budget", false},
+	}
+
+	for _, tt := range tests {
+		f := Filters{Page: 1, PageSize: 10, Sort: tt.sort, SortSafeList: []string{"id", "year", "-year", "title", "runtime"}}
+
+		v := validation.New()
+		ValidateFilters(v, f)
+		if v.Valid() != tt.valid {
+			t.Errorf("%s: got valid %t, want %t (%v)", tt.sort, v.Valid(), tt.valid, v.Errors)
+		}
+	}
+}
+
+func TestValidateFiltersCursor(t *testing.T) {
+	year := Filters{Page: 1, PageSize: 10, Sort: "year", SortSafeList: []string{"year", "-year"}}
+	issued := year.encodeCursor([]string{"1999"}, 42)
+
+	tests := []struct {
+		name   string
+		cursor string
+		sort   string
+		page   int
+		valid  bool
+	}{
+		{"valid", issued, "year", 1, true},
+		{"garbage", "not-a-cursor", "year", 1, false},
+		{"other sort", issued, "-year", 1, false},
+		{"with page", issued, "year", 2, false},
+	}
+
+	for _, tt := range tests {
+		f := year
+		f.Cursor, f.Sort, f.Page = tt.cursor, tt.sort, tt.page
+
+		v := validation.New()
+		ValidateFilters(v, f)
+		if v.Valid() != tt.valid {
+			t.Errorf("%s: got valid %t, want %t (%v)", tt.name, v.Valid(), tt.valid, v.Errors)
+		}
+	}
+}
+
+func TestGetAllQueryLocalizedColumns(t *testing.T) {
+	filters := Filters{Sort: "title", SortSafeList: []string{"title"}, Page: 1, PageSize: 10}
+	projection := Projection{Languages: []string{"fr-ca", "fr"}}
+
+	query, _, _, err := getAllQuery(MovieCriteria{Search: TextSearch{Config: "simple"}}, filters, projection)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ORDER BY title must name a single output column, the original title
+	selectList := query[strings.Index(query, "SELECT")+len("SELECT") : strings.Index(query, "FROM movies")]
+	names := map[string]int{}
+	for _, column := range splitSelectList(selectList) {
+		names[outputName(column)]++
+	}
+
+	if names["title"] != 1 || names["localized_title"] != 1 {
+		t.Errorf("got output columns %v, want title and localized_title once each", names)
+	}
+	if !strings.Contains(query, "ORDER BY title ASC") {
+		t.Errorf("query isn't sorted by title:\n%s", query)
+	}
+}
+
+// splitSelectList splits a SELECT list at the commas outside of parentheses and strings.
+func splitSelectList(list string) []string {
+	var (
+		columns []string
+		depth   int
+		quoted  bool
+		start   int
+	)
+
+	for i, r := range list {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case quoted:
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			columns = append(columns, strings.TrimSpace(list[start:i]))
+			start = i + 1
+		}
+	}
+
+	return append(columns, strings.TrimSpace(list[start:]))
+}
+
+// outputName returns the name Postgres gives the output column of a SELECT expression: its
+// alias, the column it reads, or the column selected by a scalar subquery.
+func outputName(expr string) string {
+	if i := strings.LastIndex(expr, " AS "); i >= 0 && !strings.Contains(expr[i:], ")") {
+		return strings.TrimSpace(expr[i+len(" AS "):])
+	}
+
+	if strings.HasPrefix(expr, "(") {
+		fields := strings.Fields(strings.TrimPrefix(expr, "("))
+		if len(fields) > 1 && fields[0] == "SELECT" {
+			expr = fields[1]
+		}
+	}
+
+	return expr[strings.LastIndex(expr, ".")+1:]
+}
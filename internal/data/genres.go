@@ -0,0 +1,347 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDuplicateGenre = errors.New("duplicate genre")
+	ErrGenreInUse     = errors.New("genre in use")
+)
+
+// GenreSlugRX matches the canonical spelling of a genre, e.g. "sci-fi".
+var GenreSlugRX = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Genre is an entry of the managed genre vocabulary. Movies store the slug; the aliases
+// are other spellings which are resolved to it.
+type Genre struct {
+	Slug      string    `json:"slug" example:"sci-fi"`
+	Name      string    `json:"name" example:"Science Fiction"`
+	Aliases   []string  `json:"aliases" example:"science fiction,scifi"`
+	CreatedAt time.Time `json:"created_at"`
+	Version   int32     `json:"version"`
+}
+
+// GenreModel struct which wrap a sql.DB connection pool
+type GenreModel struct {
+	DB *sql.DB
+}
+
+// GenreVocabulary maps the slugs and aliases of the managed genres, lower-cased, to the
+// slugs they stand for.
+type GenreVocabulary map[string]string
+
+// normalizeGenre returns the lower-cased form of a genre spelling under which it's
+// looked up, and its slugified form, e.g. "science-fiction" for "Science Fiction".
+func normalizeGenre(name string) (string, string) {
+	lowered := strings.ToLower(strings.TrimSpace(name))
+
+	slugified := strings.Trim(strings.Join(strings.FieldsFunc(lowered, func(r rune) bool {
+		return (r < 'a' || r > 'z') && (r < '0' || r > '9')
+	}), "-"), "-")
+
+	return lowered, slugified
+}
+
+// Resolve returns the slug of the genre a spelling stands for, matching slugs and aliases
+// regardless of case, spaces and punctuation.
+func (vocabulary GenreVocabulary) Resolve(name string) (string, bool) {
+	lowered, slugified := normalizeGenre(name)
+
+	if slug, ok := vocabulary[lowered]; ok {
+		return slug, true
+	}
+
+	slug, ok := vocabulary[slugified]
+	return slug, ok
+}
+
+// Canonical resolves the spellings of genre filters to their slugs. Unknown genres are
+// kept as they are, so they match no movie.
+func (vocabulary GenreVocabulary) Canonical(names []string) []string {
+	genres := make([]string, len(names))
+	for i, name := range names {
+		slug, ok := vocabulary.Resolve(name)
+		if !ok {
+			slug = name
+		}
+		genres[i] = slug
+	}
+	return genres
+}
+
+func ValidateGenre(v *validation.Validator, genre *Genre) {
+	v.Check(genre.Slug != "", "slug", "must be provided")
+	v.Check(len(genre.Slug) <= 50, "slug", "must not be more than 50 bytes long")
+	v.Check(validation.Matches(genre.Slug, GenreSlugRX), "slug", "must only contain lower-case letters, digits and single hyphens")
+
+	v.Check(genre.Name != "", "name", "must be provided")
+	v.Check(len(genre.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(len(genre.Aliases) <= 20, "aliases", "must not contain more than 20 aliases")
+	for i, alias := range genre.Aliases {
+		// Aliases are matched case-insensitively, so they're stored lower-cased
+		genre.Aliases[i], _ = normalizeGenre(alias)
+		v.Check(genre.Aliases[i] != "", "aliases", "must not contain empty values")
+		v.Check(len(genre.Aliases[i]) <= 100, "aliases", "must not contain values more than 100 bytes long")
+		v.Check(genre.Aliases[i] != genre.Slug, "aliases", "must not contain the slug")
+	}
+	v.Check(validation.Unique(genre.Aliases), "aliases", "must not contain duplicate values")
+}
+
+// Insert adds a genre together with its aliases. ErrDuplicateGenre is returned when the
+// slug or one of the aliases already names a genre.
+func (m *GenreModel) Insert(genre *Genre) error {
+	query := `
+		INSERT INTO genres (slug, name)
+		VALUES ($1, $2)
+		RETURNING created_at, version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, genre.Slug, genre.Name).Scan(&genre.CreatedAt, &genre.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "genres_pkey"`:
+			return ErrDuplicateGenre
+		default:
+			return err
+		}
+	}
+
+	err = setGenreAliases(ctx, tx, genre)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// setGenreAliases replaces the aliases of a genre. A spelling can only name one genre, so
+// the slug must not be another genre's alias, and the aliases must not be other genres'
+// slugs or aliases.
+func setGenreAliases(ctx context.Context, tx *sql.Tx, genre *Genre) error {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM genres WHERE slug = ANY($1) AND slug <> $2)
+		    OR EXISTS (SELECT 1 FROM genre_aliases WHERE alias = $2)
+	`
+
+	var taken bool
+
+	err := tx.QueryRowContext(ctx, query, pq.Array(genre.Aliases), genre.Slug).Scan(&taken)
+	if err != nil {
+		return err
+	}
+
+	if taken {
+		return ErrDuplicateGenre
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM genre_aliases WHERE slug = $1`, genre.Slug)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO genre_aliases (alias, slug)
+		SELECT alias, $2 FROM unnest($1::text[]) AS alias
+	`
+
+	_, err = tx.ExecContext(ctx, query, pq.Array(genre.Aliases), genre.Slug)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "genre_aliases_pkey"`:
+			return ErrDuplicateGenre
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+const genreColumns = `
+	genres.slug, genres.name,
+	ARRAY(SELECT alias FROM genre_aliases WHERE genre_aliases.slug = genres.slug ORDER BY alias),
+	genres.created_at, genres.version`
+
+// GetAll returns every genre of the vocabulary, ordered by slug.
+func (m *GenreModel) GetAll() ([]*Genre, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM genres
+		ORDER BY slug
+	`, genreColumns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+	for rows.Next() {
+		var genre Genre
+
+		err = rows.Scan(&genre.Slug, &genre.Name, pq.Array(&genre.Aliases), &genre.CreatedAt, &genre.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		genres = append(genres, &genre)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
+
+func (m *GenreModel) Get(slug string) (*Genre, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM genres
+		WHERE slug = $1
+	`, genreColumns)
+
+	var genre Genre
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, slug).Scan(&genre.Slug, &genre.Name, pq.Array(&genre.Aliases), &genre.CreatedAt, &genre.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &genre, nil
+}
+
+// Update changes the name and aliases of a genre. The slug can't be changed, since it's
+// what movies store.
+func (m *GenreModel) Update(genre *Genre) error {
+	query := `
+		UPDATE genres
+		SET name = $1, version = version + 1
+		WHERE slug = $2 AND version = $3
+		RETURNING version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, genre.Name, genre.Slug, genre.Version).Scan(&genre.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrConflictEdit
+		default:
+			return err
+		}
+	}
+
+	err = setGenreAliases(ctx, tx, genre)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes a genre and its aliases. Genres which are still used by a movie, trashed
+// ones included, can't be deleted and ErrGenreInUse is returned.
+func (m *GenreModel) Delete(slug string) error {
+	query := `
+		DELETE FROM genres
+		WHERE slug = $1 AND NOT EXISTS (SELECT 1 FROM movies WHERE genres @> ARRAY[$1])
+		RETURNING slug
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, slug).Scan(&slug)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			// Tell a missing genre apart from one which is in use
+			_, err = m.Get(slug)
+			if err != nil {
+				return err
+			}
+			return ErrGenreInUse
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Vocabulary returns the slugs and aliases of every genre, for resolving the genres of
+// movies.
+func (m *GenreModel) Vocabulary() (GenreVocabulary, error) {
+	query := `
+		SELECT slug, slug FROM genres
+		UNION ALL
+		SELECT alias, slug FROM genre_aliases
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vocabulary := make(GenreVocabulary)
+	for rows.Next() {
+		var spelling, slug string
+
+		err = rows.Scan(&spelling, &slug)
+		if err != nil {
+			return nil, err
+		}
+
+		vocabulary[spelling] = slug
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return vocabulary, nil
+}
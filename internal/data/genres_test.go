@@ -0,0 +1,37 @@
+package data
+
+import (
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"reflect"
+	"testing"
+)
+
+func TestValidateMovieGenres(t *testing.T) {
+	vocabulary := GenreVocabulary{"drama": "drama", "sci-fi": "sci-fi", "science fiction": "sci-fi", "film-noir": "film-noir"}
+
+	tests := []struct {
+		genres []string
+		want   []string
+		valid  bool
+	}{
+		{[]string{"drama", "sci-fi"}, []string{"drama", "sci-fi"}, true},
+		{[]string{"Drama", " Science Fiction "}, []string{"drama", "sci-fi"}, true},
+		{[]string{"Film Noir"}, []string{"film-noir"}, true},
+		{[]string{"sci-fi", "science fiction"}, nil, false},
+		{[]string{"drama", "western"}, nil, false},
+	}
+
+	for _, tt := range tests {
+		movie := &Movie{Title: "Casablanca", Year: 1942, Runtime: 102, Genres: append([]string(nil), tt.genres...)}
+
+		v := validation.New()
+		ValidateMovie(v, movie, vocabulary)
+		if v.Valid() != tt.valid {
+			t.Errorf("%v: got valid %t, want %t (%v)", tt.genres, v.Valid(), tt.valid, v.Errors)
+			continue
+		}
+		if tt.valid && !reflect.DeepEqual(movie.Genres, tt.want) {
+			t.Errorf("%v: got genres %v, want %v", tt.genres, movie.Genres, tt.want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	ErrIdempotencyKeyReused     = errors.New("idempotency key reused")
+	ErrIdempotencyKeyInProgress = errors.New("idempotency key in progress")
+)
+
+// IdempotencyKey identifies a request made with an Idempotency-Key header. The key is
+// scoped to the user and route, and the fingerprint tells retries apart from other
+// requests reusing the key.
+type IdempotencyKey struct {
+	UserID      int64
+	Method      string
+	Path        string
+	Key         string
+	Fingerprint []byte
+}
+
+// IdempotentResponse is the response stored for an idempotency key, replayed on retries.
+type IdempotentResponse struct {
+	Status int
+	Header map[string][]string
+	Body   []byte
+}
+
+// IdempotencyModel struct which wrap a sql.DB connection pool
+type IdempotencyModel struct {
+	DB *sql.DB
+}
+
+// Begin claims an idempotency key for a request. Keys older than ttl are claimed again,
+// even before DeleteExpired removed them. A nil response means the key is new and the
+// request should be processed; otherwise the stored response of the first request is
+// returned. ErrIdempotencyKeyInProgress is returned while the first request is still
+// processed, and ErrIdempotencyKeyReused when the key was used for a different request.
+func (m *IdempotencyModel) Begin(key *IdempotencyKey, ttl time.Duration) (*IdempotentResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO idempotency_keys (user_id, method, path, key, fingerprint)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, method, path, key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint, status = NULL, headers = NULL, body = NULL, created_at = NOW()
+		WHERE idempotency_keys.created_at < $6
+	`
+
+	args := []any{key.UserID, key.Method, key.Path, key.Key, key.Fingerprint, time.Now().Add(-ttl)}
+
+	results, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	rowAffected, err := results.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowAffected == 1 {
+		return nil, nil
+	}
+
+	// The key was already used, tell a retry apart from another request
+	query = `
+		SELECT fingerprint, status, headers, body
+		FROM idempotency_keys
+		WHERE user_id = $1 AND method = $2 AND path = $3 AND key = $4
+	`
+
+	var (
+		fingerprint []byte
+		status      sql.NullInt32
+		headers     []byte
+		response    IdempotentResponse
+	)
+
+	err = m.DB.QueryRowContext(ctx, query, args[:4]...).Scan(&fingerprint, &status, &headers, &response.Body)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			// The first request failed and released the key in the meantime
+			return m.Begin(key, ttl)
+		default:
+			return nil, err
+		}
+	}
+
+	if !bytes.Equal(fingerprint, key.Fingerprint) {
+		return nil, ErrIdempotencyKeyReused
+	}
+
+	if !status.Valid {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+
+	response.Status = int(status.Int32)
+
+	err = json.Unmarshal(headers, &response.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// Complete stores the response of the request an idempotency key was claimed for.
+func (m *IdempotencyModel) Complete(key *IdempotencyKey, response *IdempotentResponse) error {
+	headers, err := json.Marshal(response.Header)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE idempotency_keys
+		SET status = $1, headers = $2, body = $3
+		WHERE user_id = $4 AND method = $5 AND path = $6 AND key = $7
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{response.Status, headers, response.Body, key.UserID, key.Method, key.Path, key.Key}
+
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// DeleteExpired removes the idempotency keys older than ttl.
+func (m *IdempotencyModel) DeleteExpired(ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE created_at < $1`, time.Now().Add(-ttl))
+	return err
+}
+
+// Release forgets an idempotency key whose request failed, so that it can be retried.
+func (m *IdempotencyModel) Release(key *IdempotencyKey) error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND method = $2 AND path = $3 AND key = $4 AND status IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, key.UserID, key.Method, key.Path, key.Key)
+	return err
+}
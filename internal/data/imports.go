@@ -0,0 +1,195 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// MovieImport is a bulk import of movies which runs in the background. Rows which fail
+// validation are skipped and reported, the other rows are inserted.
+type MovieImport struct {
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"-"`
+	Format       string     `json:"format"`
+	Status       string     `json:"status"`
+	TotalRows    int32      `json:"total_rows"`
+	InsertedRows int32      `json:"inserted_rows"`
+	FailedRows   int32      `json:"failed_rows"`
+	Error        string     `json:"error,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+}
+
+// ImportRowError holds the validation errors of a row which couldn't be imported. Row is
+// the 1-based position of the row in the import, not counting a CSV header.
+type ImportRowError struct {
+	Row    int32             `json:"row"`
+	Errors map[string]string `json:"errors"`
+}
+
+// ImportModel struct which wrap a sql.DB connection pool
+type ImportModel struct {
+	DB *sql.DB
+}
+
+func (m *ImportModel) Insert(imp *MovieImport) error {
+	query := `
+		INSERT INTO movie_imports (user_id, format)
+		VALUES ($1, $2)
+		RETURNING id, status, created_at, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, imp.UserID, imp.Format).Scan(&imp.ID, &imp.Status, &imp.CreatedAt, &imp.UpdatedAt)
+}
+
+func (m *ImportModel) Get(id int64) (*MovieImport, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, user_id, format, status, total_rows, inserted_rows, failed_rows, error,
+		       created_at, updated_at, finished_at
+		FROM movie_imports
+		WHERE id = $1
+	`
+
+	var imp MovieImport
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&imp.ID,
+		&imp.UserID,
+		&imp.Format,
+		&imp.Status,
+		&imp.TotalRows,
+		&imp.InsertedRows,
+		&imp.FailedRows,
+		&imp.Error,
+		&imp.CreatedAt,
+		&imp.UpdatedAt,
+		&imp.FinishedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &imp, nil
+}
+
+// UpdateProgress saves the status and counters of an import together with the row errors
+// found since the last update. Imports which are no longer running are marked finished.
+func (m *ImportModel) UpdateProgress(imp *MovieImport, rowErrors []ImportRowError) error {
+	query := `
+		UPDATE movie_imports
+		SET status = $1, total_rows = $2, inserted_rows = $3, failed_rows = $4, error = $5, updated_at = NOW(),
+		    finished_at = CASE WHEN $1 IN ('completed', 'failed') THEN NOW() END
+		WHERE id = $6
+		RETURNING updated_at, finished_at
+	`
+
+	errorsQuery := `
+		INSERT INTO movie_import_errors (import_id, row_number, errors)
+		VALUES ($1, $2, $3)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, rowError := range rowErrors {
+		errs, err := json.Marshal(rowError.Errors)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, errorsQuery, imp.ID, rowError.Row, errs)
+		if err != nil {
+			return err
+		}
+	}
+
+	args := []any{imp.Status, imp.TotalRows, imp.InsertedRows, imp.FailedRows, imp.Error, imp.ID}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&imp.UpdatedAt, &imp.FinishedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetErrors returns a page of the row errors of an import, in row order.
+func (m *ImportModel) GetErrors(importID int64, filters Filters) ([]*ImportRowError, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT COUNT(*) OVER(), row_number, errors
+	FROM movie_import_errors
+	WHERE import_id = $1
+	ORDER BY %s
+	LIMIT $2 OFFSET $3`, filters.orderBy(""))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, importID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var totalRecords int
+	rowErrors := []*ImportRowError{}
+	for rows.Next() {
+		var (
+			rowError ImportRowError
+			errs     []byte
+		)
+
+		err = rows.Scan(&totalRecords, &rowError.Row, &errs)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		err = json.Unmarshal(errs, &rowError.Errors)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		rowErrors = append(rowErrors, &rowError)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return rowErrors, metadata, nil
+}
@@ -11,26 +11,50 @@ var (
 )
 
 type IModel interface {
-	Insert(*Movie) error
+	Insert(*Movie, int64) error
 	Get(int64) (*Movie, error)
-	Update(*Movie) error
-	Delete(int64) error
+	Update(*Movie, int64) error
+	Delete(int64, int64) error
 }
 
 // Models struct which is base model
 type Models struct {
-	Movies      MovieModel
-	Permissions PermissionModel
-	Users       UserModel
-	Tokens      TokenModel
+	Movies          MovieModel
+	Permissions     PermissionModel
+	Users           UserModel
+	Tokens          TokenModel
+	People          PersonModel
+	Credits         CreditModel
+	Reviews         ReviewModel
+	Watchlist       WatchlistModel
+	Watched         WatchedModel
+	Revisions       RevisionModel
+	Imports         ImportModel
+	Genres          GenreModel
+	Titles          TitleModel
+	Recommendations RecommendationModel
+	Idempotency     IdempotencyModel
+	Revocations     RevocationModel
 }
 
 // NewModels is a constructor
 func NewModels(db *sql.DB) *Models {
 	return &Models{
-		Movies:      MovieModel{DB: db},
-		Permissions: PermissionModel{DB: db},
-		Users:       UserModel{DB: db},
-		Tokens:      TokenModel{DB: db},
+		Movies:          MovieModel{DB: db},
+		Permissions:     PermissionModel{DB: db},
+		Users:           UserModel{DB: db},
+		Tokens:          TokenModel{DB: db},
+		People:          PersonModel{DB: db},
+		Credits:         CreditModel{DB: db},
+		Reviews:         ReviewModel{DB: db},
+		Watchlist:       WatchlistModel{DB: db},
+		Watched:         WatchedModel{DB: db},
+		Revisions:       RevisionModel{DB: db},
+		Imports:         ImportModel{DB: db},
+		Genres:          GenreModel{DB: db},
+		Titles:          TitleModel{DB: db},
+		Recommendations: RecommendationModel{DB: db},
+		Idempotency:     IdempotencyModel{DB: db},
+		Revocations:     RevocationModel{DB: db, cache: newRevocationCache()},
 	}
 }
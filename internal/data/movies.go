@@ -1,25 +1,135 @@
 package data
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/lib/pq"
 	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 )
 
 /* Fields are capital, which is necessary for encoding/json package*/
 
 type Movie struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`
-	Runtime   Runtime   `json:"runtime"` // <- Custom Runtime `type`
-	Genres    []string  `json:"genres"`
-	Version   int32     `json:"version"`
+	ID            int64      `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	Title         string     `json:"title"`
+	OriginalTitle string     `json:"original_title,omitempty"` // set when title is a localized title
+	Year          int32      `json:"year,omitempty"`
+	Runtime       Runtime    `json:"runtime"` // <- Custom Runtime `type`
+	Genres        []string   `json:"genres"`
+	Version       int32      `json:"version"`
+	AverageRating float64    `json:"average_rating"`
+	RatingCount   int32      `json:"rating_count"`
+	Relevance     float32    `json:"relevance,omitempty"` // rank of a full-text search or a recommendation
+	Highlight     string     `json:"highlight,omitempty"` // title with search matches wrapped in <mark>
+	PosterURL     string     `json:"poster_url,omitempty"`
+	BackdropURL   string     `json:"backdrop_url,omitempty"`
+	DeletedAt     *time.Time `json:"deleted_at,omitempty"`
+	Credits       []*Credit  `json:"credits,omitempty"`
+	Reviews       []*Review  `json:"reviews,omitempty"`
+
+	localizedTitle sql.NullString
+}
+
+// MovieFields lists the fields of a movie which can be projected. Listings with a
+// full-text search also have relevance and highlight.
+var MovieFields = []string{"id", "created_at", "title", "year", "runtime", "genres", "version", "average_rating", "rating_count", "poster_url", "backdrop_url"}
+
+// movieColumn maps a field of a movie to the SELECT expression which reads it.
+type movieColumn struct {
+	field  string
+	expr   string
+	target func(*Movie) any
+}
+
+var movieColumns = []movieColumn{
+	{"id", "id", func(m *Movie) any { return &m.ID }},
+	{"created_at", "created_at", func(m *Movie) any { return &m.CreatedAt }},
+	{"title", "title", func(m *Movie) any { return &m.Title }},
+	{"year", "year", func(m *Movie) any { return &m.Year }},
+	{"runtime", "runtime", func(m *Movie) any { return &m.Runtime }},
+	{"genres", "genres", func(m *Movie) any { return pq.Array(&m.Genres) }},
+	{"version", "version", func(m *Movie) any { return &m.Version }},
+	{"average_rating", "average_rating", func(m *Movie) any { return &m.AverageRating }},
+	{"rating_count", "rating_count", func(m *Movie) any { return &m.RatingCount }},
+	{"poster_url", imageURL(ImagePoster), func(m *Movie) any { return &m.PosterURL }},
+	{"backdrop_url", imageURL(ImageBackdrop), func(m *Movie) any { return &m.BackdropURL }},
+}
+
+const (
+	ImagePoster   = "poster"
+	ImageBackdrop = "backdrop"
+)
+
+// imageURL returns the SELECT expression of the URL an image of a movie is served at. The
+// v parameter changes with each upload, so the URL can be cached indefinitely.
+func imageURL(kind string) string {
+	column := imageColumn(kind)
+	return fmt.Sprintf(`CASE WHEN %[1]s = '' THEN '' ELSE '/v1/movies/' || id || '/%[1]s?v=' || %[1]s END`, column)
+}
+
+// imageColumn returns the column storing the image of a kind.
+func imageColumn(kind string) string {
+	if kind != ImagePoster && kind != ImageBackdrop {
+		// Help prevent SQL injection.
+		panic("unsafe image kind: " + kind)
+	}
+	return kind
+}
+
+// selectMovieColumns returns the SELECT list of the columns in the projection, and a function
+// returning the matching scan destinations of a movie. The required fields are selected
+// even when they aren't projected.
+func selectMovieColumns(columns []movieColumn, p Projection, required ...string) (string, func(*Movie) []any) {
+	var (
+		exprs    []string
+		selected []movieColumn
+	)
+
+	for _, column := range columns {
+		if p.Includes(column.field) || slices.Contains(required, column.field) {
+			exprs = append(exprs, column.expr)
+			selected = append(selected, column)
+		}
+	}
+
+	targets := func(movie *Movie) []any {
+		dest := make([]any, len(selected))
+		for i, column := range selected {
+			dest[i] = column.target(movie)
+		}
+		return dest
+	}
+
+	return strings.Join(exprs, ", "), targets
+}
+
+// localizedColumns adds the title in the preferred languages of the projection to the
+// columns, and returns the argument to bind at the given placeholder. Movies without a
+// title in any of the languages keep their original title.
+func localizedColumns(columns []movieColumn, p Projection, placeholder int) ([]movieColumn, []any) {
+	if len(p.Languages) == 0 {
+		return columns, nil
+	}
+
+	// The alias keeps the output column apart from the original title, which listings are
+	// sorted by
+	localized := movieColumn{"title", localizedTitleExpr(placeholder) + " AS localized_title", func(m *Movie) any { return &m.localizedTitle }}
+	return append(slices.Clone(columns), localized), []any{pq.Array(p.Languages)}
+}
+
+// localize replaces the title of a movie by the localized title read with it, if any.
+func (m *Movie) localize() {
+	if m.localizedTitle.Valid && m.localizedTitle.String != m.Title {
+		m.OriginalTitle, m.Title = m.Title, m.localizedTitle.String
+	}
 }
 
 // MovieModel struct which wrap a sql.DB connection pool
@@ -27,7 +137,9 @@ type MovieModel struct {
 	DB *sql.DB
 }
 
-func ValidateMovie(v *validation.Validator, input *Movie) {
+// ValidateMovie checks a movie before it's stored. The genres must be part of the
+// vocabulary; aliases are replaced by the slugs they stand for.
+func ValidateMovie(v *validation.Validator, input *Movie, genres GenreVocabulary) {
 	v.Check(input.Title != "", "title", "must be provided")
 	v.Check(len(input.Title) <= 500, "title", "must not be more than 500 bytes long")
 
@@ -41,10 +153,20 @@ func ValidateMovie(v *validation.Validator, input *Movie) {
 	v.Check(input.Genres != nil, "genres", "must be provided")
 	v.Check(len(input.Genres) >= 1, "genres", "must contains at least 1 genre")
 	v.Check(len(input.Genres) <= 5, "genres", "must not contain more than 5 genre")
+	for i, genre := range input.Genres {
+		slug, ok := genres.Resolve(genre)
+		if !ok {
+			v.AddError("genres", fmt.Sprintf("unknown genre %q", genre))
+			continue
+		}
+		input.Genres[i] = slug
+	}
 	v.Check(validation.Unique(input.Genres), "genres", "must not contain duplicate values")
 }
 
-func (m *MovieModel) Insert(movie *Movie) error {
+// Insert adds a movie and records its first revision, made by the user with the given
+// ID, in the same transaction.
+func (m *MovieModel) Insert(movie *Movie, userID int64) error {
 	query := `
 		INSERT INTO movies (title, year, runtime, genres)
 		VALUES ($1, $2, $3, $4)
@@ -54,32 +176,201 @@ func (m *MovieModel) Insert(movie *Movie) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	// Wrap input into []args
 	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
 
 	// Query a row then scan value into destination
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	if err != nil {
+		return err
+	}
 
+	err = insertRevision(ctx, tx, movie, userID, RevisionInsert, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (m *MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+// InsertBatch adds several movies, and their first revisions, in a single transaction.
+// Either all of the movies are inserted or none of them are.
+func (m *MovieModel) InsertBatch(movies []*Movie, userID int64) error {
+	query := `
+		INSERT INTO movies (title, year, runtime, genres)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, movie := range movies {
+		args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+
+		err = stmt.QueryRowContext(ctx, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+		if err != nil {
+			return err
+		}
+
+		err = insertRevision(ctx, tx, movie, userID, RevisionInsert, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// MovieCriteria holds the filters selecting the movies of a listing. Zero values don't
+// filter: a zero person ID matches movies crediting anyone, and an empty search query
+// matches every movie.
+type MovieCriteria struct {
+	Title         string
+	Genres        []string // the movie has all of these genres
+	GenresAny     []string // the movie has at least one of these genres
+	GenresExclude []string // the movie has none of these genres
+	Person        int64
+	YearMin       int32
+	YearMax       int32
+	RuntimeMin    Runtime
+	RuntimeMax    Runtime
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Search        TextSearch
+}
+
+func ValidateMovieCriteria(v *validation.Validator, c MovieCriteria) {
+	v.Check(c.Person >= 0, "person", "must not be negative")
+	v.Check(c.YearMin >= 0, "year_min", "must not be negative")
+	v.Check(c.YearMax >= 0, "year_max", "must not be negative")
+	v.Check(c.YearMax == 0 || c.YearMin <= c.YearMax, "year_max", "must not be less than year_min")
+	v.Check(c.RuntimeMin >= 0, "runtime_min", "must not be negative")
+	v.Check(c.RuntimeMax >= 0, "runtime_max", "must not be negative")
+	v.Check(c.RuntimeMax == 0 || c.RuntimeMin <= c.RuntimeMax, "runtime_max", "must not be less than runtime_min")
+	v.Check(c.CreatedBefore.IsZero() || c.CreatedAfter.Before(c.CreatedBefore), "created_before", "must be later than created_after")
+	v.Check(len(c.GenresAny) <= 20, "genres_any", "must not contain more than 20 genres")
+	v.Check(len(c.GenresExclude) <= 20, "genres_exclude", "must not contain more than 20 genres")
+	ValidateTextSearch(v, c.Search)
+}
+
+// movieMatches returns the FROM and WHERE clauses selecting the movies which match the
+// criteria of a listing, and their arguments. The search query is always bound as $4.
+//
+// The search query is ranked against the weighted title and genres document, plus the
+// trigram word similarity to the title for fuzzy searches. The lateral join exposes
+// the rank as a column so it can be sorted and paged by. Without a search query every
+// match ranks 0, so plain listings don't build the search document of each row.
+func movieMatches(c MovieCriteria) (string, []any) {
+	args := []any{
+		c.Title, pq.Array(c.Genres), c.Person, c.Search.Query, c.Search.Fuzzy,
+		pq.Array(c.GenresAny), pq.Array(c.GenresExclude),
+		c.YearMin, c.YearMax, c.RuntimeMin, c.RuntimeMax,
+		sql.NullTime{Time: c.CreatedAfter, Valid: !c.CreatedAfter.IsZero()},
+		sql.NullTime{Time: c.CreatedBefore, Valid: !c.CreatedBefore.IsZero()},
+	}
+
+	relevance := "0::real"
+	if c.Search.Query != "" {
+		relevance = fmt.Sprintf(`ts_rank(movies_search_document('%s', title, genres), search_query)
+		       + CASE WHEN $5 THEN word_similarity($4, title) ELSE 0 END`, c.Search.config())
+	}
+
+	return fmt.Sprintf(`
+	FROM movies
+	CROSS JOIN websearch_to_tsquery('%[1]s', $4) AS search_query
+	CROSS JOIN LATERAL (
+		SELECT %[2]s AS relevance
+	) AS search
+	WHERE deleted_at IS NULL
+	AND (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = ''
+		OR id IN (SELECT movie_id FROM movie_titles WHERE to_tsvector('simple', movie_titles.title) @@ plainto_tsquery('simple', $1)))
+	AND (genres @> $2 OR $2 = '{}')
+	AND (id IN (SELECT movie_id FROM movie_credits WHERE person_id = $3) OR $3 = 0)
+	AND (movies_search_document('%[1]s', title, genres) @@ search_query OR ($5 AND $4 <%% title) OR $4 = ''
+		OR id IN (SELECT movie_id FROM movie_titles WHERE to_tsvector('%[1]s', movie_titles.title) @@ search_query))
+	AND (genres && $6 OR $6 = '{}')
+	AND NOT (genres && $7)
+	AND (year >= $8 OR $8 = 0)
+	AND (year <= $9 OR $9 = 0)
+	AND (runtime >= $10 OR $10 = 0)
+	AND (runtime <= $11 OR $11 = 0)
+	AND (created_at > $12 OR $12 IS NULL)
+	AND (created_at < $13 OR $13 IS NULL)`, c.Search.config(), relevance), args
+}
+
+// getAllQuery renders the query of GetAll and its arguments. The scan targets of a row
+// follow its total records column.
+func getAllQuery(criteria MovieCriteria, filters Filters, projection Projection) (string, []any, func(*Movie) []any, error) {
 	//  Approach: Full-time search
 	// Ex: /v1/api/title="panther"
 	// Record: {"title": "black panther"}
 	// Process: re = "black" "panther" @@ (matches) query = "panther" => True
+	matches, args := movieMatches(criteria)
+
+	// In keyset mode the page starts after the cursor row, and the total isn't counted:
+	// counting every match is what makes deep offset pages slow.
+	totalRecordsColumn, keyset, limit := "COUNT(*) OVER()", "TRUE", filters.limit()
+	if filters.Cursor != "" {
+		condition, keysetArgs, err := filters.keysetCondition(len(args) + 1)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		totalRecordsColumn, keyset, limit = "0", condition, filters.limit()+1
+		args = append(args, keysetArgs...)
+	}
+
+	columns := append(slices.Clone(movieColumns),
+		movieColumn{"relevance", "relevance", func(m *Movie) any { return &m.Relevance }},
+		movieColumn{"highlight", fmt.Sprintf(`CASE WHEN $4 = '' THEN '' ELSE ts_headline('%s', title, search_query, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true') END`, criteria.Search.config()),
+			func(m *Movie) any { return &m.Highlight }},
+	)
+	columns, localizedArgs := localizedColumns(columns, projection, len(args)+1)
+	args = append(args, localizedArgs...)
+
+	selectList, targets := selectMovieColumns(columns, projection, append([]string{"id"}, filters.sortColumns()...)...)
+
 	query := fmt.Sprintf(`
-	SELECT COUNT(*) OVER(), id, created_at, title, year, runtime, genres, version
-	FROM movies
-	WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-	AND (genres @> $2 OR $2 = '{}')
-	ORDER BY %s %s, id ASC
-	LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+	SELECT %[1]s, %[7]s
+	%[2]s
+	AND %[3]s
+	ORDER BY %[4]s, id ASC
+	LIMIT $%[5]d OFFSET $%[6]d`, totalRecordsColumn, matches, keyset, filters.orderBy(""), len(args)+1, len(args)+2, selectList)
+
+	args = append(args, limit, filters.offset())
+
+	return query, args, targets, nil
+}
+
+// GetAll returns the movies matching the criteria. Only the projected fields are read,
+// plus the id and sort columns which paging relies on.
+func (m *MovieModel) GetAll(criteria MovieCriteria, filters Filters, projection Projection) ([]*Movie, Metadata, error) {
+	query, args, targets, err := getAllQuery(criteria, filters, projection)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{title, pq.Array(genres), filters.limit(), filters.offset()}
-
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
@@ -93,6 +384,265 @@ func (m *MovieModel) GetAll(title string, genres []string, filters Filters) ([]*
 		// init an empty struct to hold the data for an individual movie
 		var movie Movie
 
+		err = rows.Scan(append([]any{&totalRecords}, targets(&movie)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		movie.localize()
+
+		// Append movie struct into movies slice
+		movies = append(movies, &movie)
+	}
+
+	//Retrieve any error that was encountered during the iteration
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	if filters.Cursor != "" {
+		// One extra row was fetched to find out whether another page follows
+		metadata := Metadata{PageSize: filters.PageSize, Cursor: filters.Cursor}
+		if len(movies) > filters.PageSize {
+			movies = movies[:filters.PageSize]
+			metadata.NextCursor = movies[len(movies)-1].cursor(filters)
+		}
+		return movies, metadata, nil
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	if filters.Page < metadata.LastPage {
+		// Offset pages hand out a cursor as well, so clients can switch to keyset paging
+		metadata.NextCursor = movies[len(movies)-1].cursor(filters)
+	}
+	return movies, metadata, nil
+}
+
+// cursor returns the keyset cursor continuing after the movie in the given sort order.
+func (m *Movie) cursor(filters Filters) string {
+	var values []string
+
+	for _, column := range filters.sortColumns() {
+		var value string
+
+		switch column {
+		case "title":
+			// Listings are sorted by the original title, even when it's localized
+			value = cmp.Or(m.OriginalTitle, m.Title)
+		case "year":
+			value = strconv.FormatInt(int64(m.Year), 10)
+		case "runtime":
+			value = strconv.FormatInt(int64(m.Runtime), 10)
+		case "average_rating":
+			value = strconv.FormatFloat(m.AverageRating, 'f', -1, 64)
+		case "rating_count":
+			value = strconv.FormatInt(int64(m.RatingCount), 10)
+		case "relevance":
+			value = strconv.FormatFloat(float64(m.Relevance), 'f', -1, 32)
+		}
+
+		values = append(values, value)
+	}
+
+	return filters.encodeCursor(values, m.ID)
+}
+
+func (m *MovieModel) Get(id int64) (*Movie, error) {
+	return m.GetFields(id, Projection{})
+}
+
+// GetFields returns a movie with only the projected fields read, plus the id and version.
+// The title is localized to the preferred languages of the projection.
+func (m *MovieModel) GetFields(id int64, projection Projection) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	columns, localizedArgs := localizedColumns(movieColumns, projection, 2)
+	selectList, targets := selectMovieColumns(columns, projection, "id", "version")
+
+	query := fmt.Sprintf(`
+		SELECT %s FROM movies
+		WHERE id = $1 AND deleted_at IS NULL
+	`, selectList)
+
+	var movie Movie
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, append([]any{id}, localizedArgs...)...).Scan(targets(&movie)...)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	movie.localize()
+	return &movie, nil
+}
+
+// Update saves the changes to a movie if it is still at movie.Version, and records the
+// revision made by the user with the given ID. A movie edited in the meantime is
+// reported as ErrConflictEdit.
+func (m *MovieModel) Update(movie *Movie, userID int64) error {
+	return m.update(movie, userID, RevisionUpdate)
+}
+
+// Revert sets a movie back to the state recorded by a revision. It goes through the same
+// optimistic locking as Update, so movie.Version must be the version the revert is based on.
+func (m *MovieModel) Revert(movie *Movie, revision *Revision, userID int64) error {
+	movie.Title = revision.Snapshot.Title
+	movie.Year = revision.Snapshot.Year
+	movie.Runtime = revision.Snapshot.Runtime
+	movie.Genres = revision.Snapshot.Genres
+
+	return m.update(movie, userID, RevisionRevert)
+}
+
+func (m *MovieModel) update(movie *Movie, userID int64, operation string) error {
+	selectQuery := `
+		SELECT title, year, runtime, genres FROM movies
+		WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+		FOR UPDATE
+	`
+
+	updateQuery := `
+		UPDATE movies
+		SET title = $1,year = $2,runtime= $3,genres = $4, version = version + 1
+		WHERE id = $5 AND version = $6 AND deleted_at IS NULL
+		RETURNING version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the row at the expected version, so the diff is taken against the state
+	// being replaced.
+	var before MovieSnapshot
+	err = tx.QueryRowContext(ctx, selectQuery, movie.ID, movie.Version).Scan(
+		&before.Title,
+		&before.Year,
+		&before.Runtime,
+		pq.Array(&before.Genres),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrConflictEdit
+		default:
+			return err
+		}
+	}
+
+	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ID, movie.Version}
+
+	err = tx.QueryRowContext(ctx, updateQuery, args...).Scan(&movie.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrConflictEdit
+		default:
+			return err
+		}
+	}
+
+	err = insertRevision(ctx, tx, movie, userID, operation, &before)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete moves a movie to the trash. Deleted movies are hidden from every other query
+// until they are restored or purged. A non-zero version makes the delete conditional: a
+// movie changed or deleted since it was at that version returns ErrConflictEdit.
+func (m *MovieModel) Delete(id int64, version int32, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		UPDATE movies
+		SET deleted_at = NOW(), version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL AND (version = $2 OR $2 = 0)
+		RETURNING id, title, year, runtime, genres, version
+	`
+
+	var movie Movie
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, id, version).Scan(
+		&movie.ID,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows) && version != 0:
+			return ErrConflictEdit
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	// Deleting doesn't change any field, so the diff is empty.
+	before := snapshotOf(&movie)
+	err = insertRevision(ctx, tx, &movie, userID, RevisionDelete, &before)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetAllDeleted returns a page of the movies in the trash. Movies merged into another
+// aren't in the trash.
+func (m *MovieModel) GetAllDeleted(filters Filters) ([]*Movie, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT COUNT(*) OVER(), id, created_at, title, year, runtime, genres, version, average_rating, rating_count, deleted_at
+	FROM movies
+	WHERE deleted_at IS NOT NULL
+	AND NOT EXISTS (SELECT 1 FROM movie_redirects WHERE old_id = movies.id)
+	ORDER BY %s, id ASC
+	LIMIT $1 OFFSET $2`, filters.orderBy(""))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var totalRecords int
+	movies := []*Movie{}
+	for rows.Next() {
+		var movie Movie
+
 		err = rows.Scan(
 			&totalRecords,
 			&movie.ID,
@@ -102,31 +652,37 @@ func (m *MovieModel) GetAll(title string, genres []string, filters Filters) ([]*
 			&movie.Runtime,
 			pq.Array(&movie.Genres),
 			&movie.Version,
+			&movie.AverageRating,
+			&movie.RatingCount,
+			&movie.DeletedAt,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
 
-		// Append movie struct into movies slice
 		movies = append(movies, &movie)
 	}
 
-	//Retrieve any error that was encountered during the iteration
 	if err = rows.Err(); err != nil {
 		return nil, Metadata{}, err
 	}
+
 	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
 	return movies, metadata, nil
 }
 
-func (m *MovieModel) Get(id int64) (*Movie, error) {
+// GetDeleted returns a movie in the trash. Movies which aren't in the trash, merged
+// movies included, are reported as not found.
+func (m *MovieModel) GetDeleted(id int64) (*Movie, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
 	query := `
-		SELECT id, created_at, title, year, runtime, genres, version FROM movies
-		WHERE id = $1
+		SELECT id, created_at, title, year, runtime, genres, version, average_rating, rating_count, deleted_at
+		FROM movies
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		AND NOT EXISTS (SELECT 1 FROM movie_redirects WHERE old_id = movies.id)
 	`
 
 	var movie Movie
@@ -142,8 +698,10 @@ func (m *MovieModel) Get(id int64) (*Movie, error) {
 		&movie.Runtime,
 		pq.Array(&movie.Genres),
 		&movie.Version,
+		&movie.AverageRating,
+		&movie.RatingCount,
+		&movie.DeletedAt,
 	)
-
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -156,55 +714,342 @@ func (m *MovieModel) Get(id int64) (*Movie, error) {
 	return &movie, nil
 }
 
-func (m *MovieModel) Update(movie *Movie) error {
+// Restore takes a movie out of the trash. Movies which aren't in the trash, merged movies
+// included, are reported as not found. A non-zero version makes the restore conditional
+// like Delete.
+func (m *MovieModel) Restore(id int64, version int32, userID int64) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
 	query := `
 		UPDATE movies
-		SET title = $1,year = $2,runtime= $3,genres = $4, version = version + 1
-		WHERE id = $5 AND version = $6
-		RETURNING version
+		SET deleted_at = NULL, version = version + 1
+		WHERE id = $1 AND deleted_at IS NOT NULL AND (version = $2 OR $2 = 0)
+		AND NOT EXISTS (SELECT 1 FROM movie_redirects WHERE old_id = movies.id)
+		RETURNING id, created_at, title, year, runtime, genres, version, average_rating, rating_count
 	`
 
+	var movie Movie
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ID, movie.Version}
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, id, version).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+		&movie.AverageRating,
+		&movie.RatingCount,
+	)
+
 	if err != nil {
 		switch {
+		case errors.Is(err, sql.ErrNoRows) && version != 0:
+			return nil, ErrConflictEdit
 		case errors.Is(err, sql.ErrNoRows):
-			return ErrConflictEdit
+			return nil, ErrRecordNotFound
 		default:
-			return err
+			return nil, err
 		}
 	}
-	return nil
+
+	before := snapshotOf(&movie)
+	err = insertRevision(ctx, tx, &movie, userID, RevisionRestore, &before)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &movie, nil
 }
 
-func (m *MovieModel) Delete(id int64) error {
+// GetImage returns the stored image of a kind of a movie, or an empty string when the
+// movie has none.
+func (m *MovieModel) GetImage(id int64, kind string) (string, error) {
 	if id < 1 {
-		return ErrRecordNotFound
+		return "", ErrRecordNotFound
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s FROM movies
+		WHERE id = $1 AND deleted_at IS NULL
+	`, imageColumn(kind))
+
+	var image string
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&image)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
 	}
+
+	return image, nil
+}
+
+// SetImage records the stored image of a kind of a movie, and returns the image it
+// replaces so that it can be deleted. The movie version is bumped, as its image URLs
+// change.
+func (m *MovieModel) SetImage(id int64, kind, image string) (string, error) {
+	if id < 1 {
+		return "", ErrRecordNotFound
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE movies
+		SET %[1]s = $1, version = movies.version + 1
+		FROM (SELECT id, %[1]s FROM movies WHERE id = $2 AND deleted_at IS NULL FOR UPDATE) AS previous
+		WHERE movies.id = previous.id
+		RETURNING previous.%[1]s
+	`, imageColumn(kind))
+
+	var previous string
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, image, id).Scan(&previous)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return previous, nil
+}
+
+// Purge permanently deletes the movies which have been in the trash for longer than the
+// retention period, and returns the IDs of the deleted movies. Merged movies are kept
+// for their revisions.
+func (m *MovieModel) Purge(retention time.Duration) ([]int64, error) {
 	query := `
 		DELETE FROM movies
-		WHERE id = $1
+		WHERE deleted_at < $1
+		AND NOT EXISTS (SELECT 1 FROM movie_redirects WHERE old_id = movies.id)
+		RETURNING id
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	results, err := m.DB.ExecContext(ctx, query, id)
+	rows, err := m.DB.QueryContext(ctx, query, time.Now().Add(-retention))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// exportFetchSize is how many rows Export fetches from its cursor at a time.
+const exportFetchSize = 1000
+
+// Export calls fn for each movie matching the title and genres filters, in ID order. Like
+// in GetAll, the title filter matches localized titles too. The rows are read from a
+// server-side cursor in small batches, so memory use doesn't grow with the size of the
+// catalogue. The export runs until ctx is cancelled, or fn returns an error.
+func (m *MovieModel) Export(ctx context.Context, title string, genres []string, fn func(*Movie) error) error {
+	query := `
+		DECLARE movies_export NO SCROLL CURSOR FOR
+		SELECT id, created_at, title, year, runtime, genres, version, average_rating, rating_count
+		FROM movies
+		WHERE deleted_at IS NULL
+		AND (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = ''
+			OR id IN (SELECT movie_id FROM movie_titles WHERE to_tsvector('simple', movie_titles.title) @@ plainto_tsquery('simple', $1)))
+		AND (genres @> $2 OR $2 = '{}')
+		ORDER BY id ASC
+	`
+
+	// A cursor only lives as long as its transaction. Being read-only, the transaction
+	// also sees a consistent snapshot of the catalogue for the whole export.
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	rowAffected, err := results.RowsAffected()
+	_, err = tx.ExecContext(ctx, query, title, pq.Array(genres))
 	if err != nil {
 		return err
 	}
 
-	if rowAffected == 0 {
-		return ErrRecordNotFound
+	for {
+		fetched, err := m.fetchExport(ctx, tx, fn)
+		if err != nil {
+			return err
+		}
+
+		if fetched < exportFetchSize {
+			break
+		}
+	}
+
+	return tx.Commit()
+}
+
+// fetchExport reads the next batch of the export cursor and returns how many rows it read.
+func (m *MovieModel) fetchExport(ctx context.Context, tx *sql.Tx, fn func(*Movie) error) (int, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("FETCH %d FROM movies_export", exportFetchSize))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	fetched := 0
+	for rows.Next() {
+		var movie Movie
+
+		err = rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.AverageRating,
+			&movie.RatingCount,
+		)
+		if err != nil {
+			return 0, err
+		}
+
+		err = fn(&movie)
+		if err != nil {
+			return 0, err
+		}
+
+		fetched++
+	}
+
+	return fetched, rows.Err()
+}
+
+// MovieSuggestion is the short form of a movie returned by autocomplete.
+type MovieSuggestion struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	Year  int32  `json:"year"`
+}
+
+// likeEscaper escapes the LIKE wildcards of user input used as a pattern prefix.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Suggest returns up to limit movies with a title, or a word in the title, starting with
+// the prefix. Titles starting with the prefix come first, then the most rated.
+func (m *MovieModel) Suggest(prefix string, limit int) ([]*MovieSuggestion, error) {
+	query := `
+		SELECT id, title, year
+		FROM movies
+		WHERE deleted_at IS NULL AND (title ILIKE $1 || '%' OR title ILIKE '% ' || $1 || '%')
+		ORDER BY title ILIKE $1 || '%' DESC, rating_count DESC, title ASC
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, likeEscaper.Replace(prefix), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []*MovieSuggestion{}
+	for rows.Next() {
+		var suggestion MovieSuggestion
+
+		err = rows.Scan(&suggestion.ID, &suggestion.Title, &suggestion.Year)
+		if err != nil {
+			return nil, err
+		}
+
+		suggestions = append(suggestions, &suggestion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
+// DidYouMean returns up to limit distinct titles which are trigram-similar to a search
+// that found nothing, most similar first.
+func (m *MovieModel) DidYouMean(search string, limit int) ([]string, error) {
+	query := `
+		SELECT title
+		FROM movies
+		WHERE deleted_at IS NULL AND $1 <% title
+		GROUP BY title
+		ORDER BY MAX(word_similarity($1, title)) DESC, title ASC
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, search, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	titles := []string{}
+	for rows.Next() {
+		var title string
+
+		err = rows.Scan(&title)
+		if err != nil {
+			return nil, err
+		}
+
+		titles = append(titles, title)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return titles, nil
 }
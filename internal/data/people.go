@@ -0,0 +1,203 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"time"
+)
+
+type Person struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	BirthYear int32     `json:"birth_year,omitempty"` // 0 means the birth year is unknown
+	Version   int32     `json:"version"`
+}
+
+// PersonModel struct which wrap a sql.DB connection pool
+type PersonModel struct {
+	DB *sql.DB
+}
+
+func ValidatePerson(v *validation.Validator, person *Person) {
+	v.Check(person.Name != "", "name", "must be provided")
+	v.Check(len(person.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	if person.BirthYear != 0 {
+		v.Check(person.BirthYear >= 1800, "birth_year", "must be greater than 1800")
+		v.Check(person.BirthYear <= int32(time.Now().Year()), "birth_year", "must not be in the future")
+	}
+}
+
+func (m *PersonModel) Insert(person *Person) error {
+	query := `
+		INSERT INTO people (name, birth_year)
+		VALUES ($1, NULLIF($2, 0))
+		RETURNING id, created_at, version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{person.Name, person.BirthYear}
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&person.ID, &person.CreatedAt, &person.Version)
+}
+
+// GetAll returns people whose name matches the full-text name query, or every person
+// when the name is empty.
+func (m *PersonModel) GetAll(name string, filters Filters) ([]*Person, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT COUNT(*) OVER(), id, created_at, name, COALESCE(birth_year, 0), version
+	FROM people
+	WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+	ORDER BY %s, id ASC
+	LIMIT $2 OFFSET $3`, filters.orderBy(""))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var totalRecords int
+	people := []*Person{}
+	for rows.Next() {
+		var person Person
+
+		err = rows.Scan(
+			&totalRecords,
+			&person.ID,
+			&person.CreatedAt,
+			&person.Name,
+			&person.BirthYear,
+			&person.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		people = append(people, &person)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return people, metadata, nil
+}
+
+func (m *PersonModel) Get(id int64) (*Person, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, name, COALESCE(birth_year, 0), version FROM people
+		WHERE id = $1
+	`
+
+	var person Person
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&person.ID,
+		&person.CreatedAt,
+		&person.Name,
+		&person.BirthYear,
+		&person.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &person, nil
+}
+
+func (m *PersonModel) Update(person *Person) error {
+	// The name is embedded in the credits of movies, so renaming a person bumps the version
+	// of the movies they're credited on
+	query := `
+		WITH previous AS (
+			SELECT name FROM people WHERE id = $3
+		), person AS (
+			UPDATE people
+			SET name = $1, birth_year = NULLIF($2, 0), version = version + 1
+			WHERE id = $3 AND version = $4
+			RETURNING name, version
+		), credited AS (
+			UPDATE movies SET version = version + 1
+			WHERE id IN (SELECT movie_id FROM movie_credits WHERE person_id = $3)
+			AND EXISTS (SELECT 1 FROM person, previous WHERE person.name <> previous.name)
+		)
+		SELECT version FROM person
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{person.Name, person.BirthYear, person.ID, person.Version}
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&person.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrConflictEdit
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a person record. Their credits are removed by the ON DELETE CASCADE
+// on movie_credits, and the version of the movies they were credited on is bumped like
+// on CreditModel.Delete.
+func (m *PersonModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		WITH person AS (
+			DELETE FROM people
+			WHERE id = $1
+			RETURNING id
+		), credited AS (
+			UPDATE movies SET version = version + 1
+			WHERE id IN (SELECT movie_id FROM movie_credits WHERE person_id = $1)
+			AND EXISTS (SELECT 1 FROM person)
+		)
+		SELECT id FROM person
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package data
+
+import (
+	"fmt"
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"slices"
+)
+
+// Projection selects the fields of a resource returned by a read, and the related
+// resources embedded in it. No fields means every field. Localized fields are read in the
+// first of the preferred languages they are available in.
+type Projection struct {
+	Fields         []string
+	FieldSafeList  []string
+	Expand         []string
+	ExpandSafeList []string
+	Languages      []string
+}
+
+func ValidateProjection(v *validation.Validator, p Projection) {
+	for _, field := range p.Fields {
+		v.Check(validation.PermittedValue(field, p.FieldSafeList...), "fields", fmt.Sprintf("invalid field value %q", field))
+	}
+	for _, name := range p.Expand {
+		v.Check(validation.PermittedValue(name, p.ExpandSafeList...), "expand", fmt.Sprintf("invalid expand value %q", name))
+	}
+}
+
+// Includes reports whether a field is part of the projection.
+func (p Projection) Includes(field string) bool {
+	return len(p.Fields) == 0 || slices.Contains(p.Fields, field)
+}
+
+// Expands reports whether a related resource is embedded by the projection.
+func (p Projection) Expands(name string) bool {
+	return slices.Contains(p.Expand, name)
+}
@@ -0,0 +1,107 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Weights of the signals a similarity score combines. They add up to 1, so scores range
+// from 0 to 1.
+const (
+	genreWeight = 0.6
+	yearWeight  = 0.25
+	titleWeight = 0.15
+)
+
+// personalWeight is the share of a personalised score which comes from the movies the user
+// interacted with, rather than from the movie recommendations are asked for.
+const personalWeight = 0.3
+
+// RecommendationModel struct which wrap a sql.DB connection pool
+type RecommendationModel struct {
+	DB *sql.DB
+}
+
+// similarityExpr returns the SQL expression of the similarity between the movies of two
+// tables or aliases: the overlap of their genres, how close their years are, and the
+// trigram similarity of their titles.
+func similarityExpr(a, b string) string {
+	return fmt.Sprintf(`(
+		%[3]g * COALESCE(cardinality(ARRAY(SELECT unnest(%[1]s.genres) INTERSECT SELECT unnest(%[2]s.genres)))::float8
+			/ NULLIF(cardinality(ARRAY(SELECT unnest(%[1]s.genres) UNION SELECT unnest(%[2]s.genres))), 0), 0)
+		+ %[4]g / (1 + abs(%[1]s.year - %[2]s.year) / 5.0)
+		+ %[5]g * similarity(%[1]s.title, %[2]s.title))`, a, b, genreWeight, yearWeight, titleWeight)
+}
+
+// Similar returns a page of the movies most similar to a movie: those sharing a genre or
+// with a similar title, ranked by relevance, the similarity score. With a userID, the
+// ranking is personalised: it also favours movies similar to those on the user's
+// watchlist, watched or rated well by them, and leaves out the movies they've already
+// watched or reviewed.
+func (m *RecommendationModel) Similar(movieID, userID int64, filters Filters) ([]*Movie, Metadata, error) {
+	columns := append(slices.Clone(movieColumns), movieColumn{"relevance", "relevance", func(m *Movie) any { return &m.Relevance }})
+	selectList, targets := selectMovieColumns(columns, Projection{}, append([]string{"id"}, filters.sortColumns()...)...)
+
+	query := fmt.Sprintf(`
+	WITH source AS (
+		SELECT id, title, year, genres FROM movies WHERE id = $1
+	), seeds AS (
+		SELECT movies.id, movies.title, movies.year, movies.genres
+		FROM movies
+		WHERE movies.id <> $1 AND movies.deleted_at IS NULL AND movies.id IN (
+			SELECT movie_id FROM watchlist_items WHERE user_id = $2
+			UNION SELECT movie_id FROM watched_movies WHERE user_id = $2
+			UNION SELECT movie_id FROM reviews WHERE user_id = $2 AND rating >= 6
+		)
+	), candidates AS (
+		SELECT movies.*,
+		       CASE WHEN $2 = 0 THEN %[1]s
+		            ELSE %[3]g * %[1]s + %[4]g * COALESCE((SELECT MAX(%[2]s) FROM seeds), 0)
+		       END AS relevance
+		FROM movies, source
+		WHERE movies.id <> source.id AND movies.deleted_at IS NULL
+		AND (movies.genres && source.genres OR similarity(movies.title, source.title) >= 0.3)
+		AND movies.id NOT IN (
+			SELECT movie_id FROM watched_movies WHERE user_id = $2
+			UNION SELECT movie_id FROM reviews WHERE user_id = $2
+		)
+	)
+	SELECT COUNT(*) OVER(), %[5]s
+	FROM candidates
+	ORDER BY %[6]s, id ASC
+	LIMIT $3 OFFSET $4`,
+		similarityExpr("movies", "source"), similarityExpr("movies", "seeds"), 1-personalWeight, personalWeight,
+		selectList, filters.orderBy(""))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var totalRecords int
+	movies := []*Movie{}
+	for rows.Next() {
+		var movie Movie
+
+		err = rows.Scan(append([]any{&totalRecords}, targets(&movie)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return movies, metadata, nil
+}
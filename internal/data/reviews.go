@@ -0,0 +1,322 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"time"
+)
+
+var (
+	ErrDuplicateReview = errors.New("duplicate review")
+)
+
+type Review struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	MovieID   int64     `json:"movie_id"`
+	UserID    int64     `json:"user_id"`
+	UserName  string    `json:"user_name"`
+	Rating    int32     `json:"rating"`
+	Body      string    `json:"body"`
+	Version   int32     `json:"version"`
+}
+
+// ReviewModel struct which wrap a sql.DB connection pool
+type ReviewModel struct {
+	DB *sql.DB
+}
+
+func ValidateReview(v *validation.Validator, review *Review) {
+	v.Check(review.Rating != 0, "rating", "must be provided")
+	v.Check(review.Rating >= 1 && review.Rating <= 10, "rating", "must be between 1 and 10")
+	v.Check(len(review.Body) <= 10_000, "body", "must not be more than 10000 bytes long")
+}
+
+// Insert adds a review and refreshes the rating aggregates of the reviewed movie in the
+// same transaction.
+func (m *ReviewModel) Insert(review *Review) error {
+	query := `
+		INSERT INTO reviews (movie_id, user_id, rating, body)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	args := []any{review.MovieID, review.UserID, review.Rating, review.Body}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&review.ID, &review.CreatedAt, &review.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "reviews_movie_id_user_id_key"`:
+			return ErrDuplicateReview
+		default:
+			return err
+		}
+	}
+
+	err = refreshMovieRating(ctx, tx, review.MovieID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *ReviewModel) Get(id int64) (*Review, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT reviews.id, reviews.created_at, reviews.movie_id, reviews.user_id, users.name,
+		       reviews.rating, reviews.body, reviews.version
+		FROM reviews
+		INNER JOIN users ON users.id = reviews.user_id
+		WHERE reviews.id = $1
+	`
+
+	var review Review
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&review.ID,
+		&review.CreatedAt,
+		&review.MovieID,
+		&review.UserID,
+		&review.UserName,
+		&review.Rating,
+		&review.Body,
+		&review.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &review, nil
+}
+
+// GetAllForMovie returns a page of the reviews written for a movie.
+func (m *ReviewModel) GetAllForMovie(movieID int64, filters Filters) ([]*Review, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT COUNT(*) OVER(), reviews.id, reviews.created_at, reviews.movie_id, reviews.user_id, users.name,
+	       reviews.rating, reviews.body, reviews.version
+	FROM reviews
+	INNER JOIN users ON users.id = reviews.user_id
+	WHERE reviews.movie_id = $1
+	ORDER BY %s, reviews.id ASC
+	LIMIT $2 OFFSET $3`, filters.orderBy("reviews"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var totalRecords int
+	reviews := []*Review{}
+	for rows.Next() {
+		var review Review
+
+		err = rows.Scan(
+			&totalRecords,
+			&review.ID,
+			&review.CreatedAt,
+			&review.MovieID,
+			&review.UserID,
+			&review.UserName,
+			&review.Rating,
+			&review.Body,
+			&review.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		reviews = append(reviews, &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return reviews, metadata, nil
+}
+
+// GetLatestForMovies returns up to limit of the most recent reviews of each movie, keyed
+// by movie ID.
+func (m *ReviewModel) GetLatestForMovies(movieIDs []int64, limit int) (map[int64][]*Review, error) {
+	query := `
+	SELECT id, created_at, movie_id, user_id, name, rating, body, version
+	FROM (
+		SELECT reviews.id, reviews.created_at, reviews.movie_id, reviews.user_id, users.name,
+		       reviews.rating, reviews.body, reviews.version,
+		       ROW_NUMBER() OVER (PARTITION BY reviews.movie_id ORDER BY reviews.created_at DESC, reviews.id DESC) AS rank
+		FROM reviews
+		INNER JOIN users ON users.id = reviews.user_id
+		WHERE reviews.movie_id = ANY($1)
+	) AS latest
+	WHERE rank <= $2
+	ORDER BY movie_id, rank`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := make(map[int64][]*Review)
+	for rows.Next() {
+		var review Review
+
+		err = rows.Scan(
+			&review.ID,
+			&review.CreatedAt,
+			&review.MovieID,
+			&review.UserID,
+			&review.UserName,
+			&review.Rating,
+			&review.Body,
+			&review.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		reviews[review.MovieID] = append(reviews[review.MovieID], &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reviews, nil
+}
+
+// Update saves the rating and body of a review, checking against the version field
+// to prevent race conditions, and refreshes the rating aggregates of the movie.
+func (m *ReviewModel) Update(review *Review) error {
+	query := `
+		UPDATE reviews
+		SET rating = $1, body = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	args := []any{review.Rating, review.Body, review.ID, review.Version}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&review.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrConflictEdit
+		default:
+			return err
+		}
+	}
+
+	err = refreshMovieRating(ctx, tx, review.MovieID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes a review and refreshes the rating aggregates of the movie.
+func (m *ReviewModel) Delete(review *Review) error {
+	query := `
+		DELETE FROM reviews
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	results, err := tx.ExecContext(ctx, query, review.ID)
+	if err != nil {
+		return err
+	}
+
+	rowAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	err = refreshMovieRating(ctx, tx, review.MovieID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// refreshMovieRating recalculates the average_rating and rating_count columns of a movie
+// from its reviews. The movie version is bumped, so that its ETag changes, but no revision
+// is recorded: a new rating isn't an edit.
+func refreshMovieRating(ctx context.Context, tx *sql.Tx, movieID int64) error {
+	// Lock the movie first. Under READ COMMITTED the aggregates are then read after any
+	// concurrent review write has committed, instead of missing its row. FOR NO KEY UPDATE
+	// doesn't conflict with the KEY SHARE lock the review's foreign key check took, so two
+	// reviews written at once wait for each other instead of deadlocking.
+	_, err := tx.ExecContext(ctx, `SELECT 1 FROM movies WHERE id = $1 FOR NO KEY UPDATE`, movieID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE movies
+		SET average_rating = COALESCE(ratings.average_rating, 0), rating_count = ratings.rating_count,
+		    version = movies.version + 1
+		FROM (SELECT AVG(rating) AS average_rating, COUNT(*) AS rating_count FROM reviews WHERE movie_id = $1) AS ratings
+		WHERE movies.id = $1
+	`
+
+	_, err = tx.ExecContext(ctx, query, movieID)
+	return err
+}
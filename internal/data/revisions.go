@@ -0,0 +1,223 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	RevisionInsert  = "insert"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+	RevisionRevert  = "revert"
+	RevisionMerge   = "merge"
+)
+
+// MovieSnapshot is the editable state of a movie stored with each revision.
+type MovieSnapshot struct {
+	Title   string   `json:"title"`
+	Year    int32    `json:"year"`
+	Runtime Runtime  `json:"runtime"`
+	Genres  []string `json:"genres"`
+}
+
+// FieldChange is the value of a field before and after a revision. From is null for
+// the fields of an inserted movie.
+type FieldChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// Revision records a change made to a movie, who made it and what it changed.
+type Revision struct {
+	MovieID   int64                  `json:"movie_id"`
+	Version   int32                  `json:"version"`
+	Operation string                 `json:"operation"`
+	UserID    int64                  `json:"user_id,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+	Snapshot  MovieSnapshot          `json:"snapshot"`
+	Diff      map[string]FieldChange `json:"diff"`
+}
+
+// RevisionModel struct which wrap a sql.DB connection pool
+type RevisionModel struct {
+	DB *sql.DB
+}
+
+func snapshotOf(movie *Movie) MovieSnapshot {
+	return MovieSnapshot{
+		Title:   movie.Title,
+		Year:    movie.Year,
+		Runtime: movie.Runtime,
+		Genres:  movie.Genres,
+	}
+}
+
+// diffSnapshots returns the fields which differ between two states of a movie. A nil
+// before reports every field as changed.
+func diffSnapshots(before *MovieSnapshot, after MovieSnapshot) map[string]FieldChange {
+	diff := make(map[string]FieldChange)
+
+	if before == nil {
+		diff["title"] = FieldChange{To: after.Title}
+		diff["year"] = FieldChange{To: after.Year}
+		diff["runtime"] = FieldChange{To: after.Runtime}
+		diff["genres"] = FieldChange{To: after.Genres}
+		return diff
+	}
+
+	if before.Title != after.Title {
+		diff["title"] = FieldChange{From: before.Title, To: after.Title}
+	}
+	if before.Year != after.Year {
+		diff["year"] = FieldChange{From: before.Year, To: after.Year}
+	}
+	if before.Runtime != after.Runtime {
+		diff["runtime"] = FieldChange{From: before.Runtime, To: after.Runtime}
+	}
+	if !slices.Equal(before.Genres, after.Genres) {
+		diff["genres"] = FieldChange{From: before.Genres, To: after.Genres}
+	}
+
+	return diff
+}
+
+// insertRevision records the state of a movie after a change, as part of the
+// transaction making the change.
+func insertRevision(ctx context.Context, tx *sql.Tx, movie *Movie, userID int64, operation string, before *MovieSnapshot) error {
+	query := `
+		INSERT INTO movie_revisions (movie_id, version, operation, user_id, snapshot, diff)
+		VALUES ($1, $2, $3, NULLIF($4, 0), $5, $6)
+	`
+
+	after := snapshotOf(movie)
+
+	snapshot, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+
+	diff, err := json.Marshal(diffSnapshots(before, after))
+	if err != nil {
+		return err
+	}
+
+	args := []any{movie.ID, movie.Version, operation, userID, snapshot, diff}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// GetAll returns a page of the revisions of a movie.
+func (m *RevisionModel) GetAll(movieID int64, filters Filters) ([]*Revision, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT COUNT(*) OVER(), movie_id, version, operation, COALESCE(user_id, 0), created_at, snapshot, diff
+	FROM movie_revisions
+	WHERE movie_id = $1
+	ORDER BY %s, id ASC
+	LIMIT $2 OFFSET $3`, filters.orderBy(""))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var totalRecords int
+	revisions := []*Revision{}
+	for rows.Next() {
+		var (
+			revision       Revision
+			snapshot, diff []byte
+		)
+
+		err = rows.Scan(
+			&totalRecords,
+			&revision.MovieID,
+			&revision.Version,
+			&revision.Operation,
+			&revision.UserID,
+			&revision.CreatedAt,
+			&snapshot,
+			&diff,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		err = revision.decode(snapshot, diff)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		revisions = append(revisions, &revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return revisions, metadata, nil
+}
+
+// Get returns the revision which produced a specific version of a movie.
+func (m *RevisionModel) Get(movieID int64, version int32) (*Revision, error) {
+	query := `
+		SELECT movie_id, version, operation, COALESCE(user_id, 0), created_at, snapshot, diff
+		FROM movie_revisions
+		WHERE movie_id = $1 AND version = $2
+	`
+
+	var (
+		revision       Revision
+		snapshot, diff []byte
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, movieID, version).Scan(
+		&revision.MovieID,
+		&revision.Version,
+		&revision.Operation,
+		&revision.UserID,
+		&revision.CreatedAt,
+		&snapshot,
+		&diff,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = revision.decode(snapshot, diff)
+	if err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+func (r *Revision) decode(snapshot, diff []byte) error {
+	err := json.Unmarshal(snapshot, &r.Snapshot)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(diff, &r.Diff)
+}
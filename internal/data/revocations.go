@@ -0,0 +1,152 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// revocationCacheTTL is how long a token found not revoked is trusted without asking the
+// database again. It bounds how long a token revoked by another server instance stays
+// usable.
+const revocationCacheTTL = 30 * time.Second
+
+// maxRevocationCacheEntries is the size above which expired cache entries are dropped.
+const maxRevocationCacheEntries = 10000
+
+// revocationCache remembers whether tokens are revoked, so authenticating a request
+// doesn't need a query every time.
+type revocationCache struct {
+	mu      sync.Mutex
+	entries map[string]revocationCacheEntry
+}
+
+type revocationCacheEntry struct {
+	revoked bool
+	userID  int64
+	until   time.Time
+}
+
+func newRevocationCache() *revocationCache {
+	return &revocationCache{entries: make(map[string]revocationCacheEntry)}
+}
+
+func (c *revocationCache) get(jti string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[jti]
+	if !ok || time.Now().After(entry.until) {
+		return false, false
+	}
+
+	return entry.revoked, true
+}
+
+func (c *revocationCache) set(jti string, entry revocationCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= maxRevocationCacheEntries {
+		now := time.Now()
+		for jti, entry := range c.entries {
+			if now.After(entry.until) {
+				delete(c.entries, jti)
+			}
+		}
+	}
+
+	c.entries[jti] = entry
+}
+
+// forgetUser drops the entries of a user's tokens, so their revocation is seen at once.
+func (c *revocationCache) forgetUser(userID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for jti, entry := range c.entries {
+		if entry.userID == userID {
+			delete(c.entries, jti)
+		}
+	}
+}
+
+// RevocationModel struct which wrap a sql.DB connection pool, fronted by a cache of the
+// revocation checks.
+type RevocationModel struct {
+	DB    *sql.DB
+	cache *revocationCache
+}
+
+// Revoke revokes an access token, identified by its jti claim, until it expires.
+func (m *RevocationModel) Revoke(jti string, userID int64, expiry time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Tokens which expired don't need to be remembered any more
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expiry < NOW()`)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO revoked_tokens (jti, user_id, expiry)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`
+
+	_, err = m.DB.ExecContext(ctx, query, jti, userID, expiry)
+	if err != nil {
+		return err
+	}
+
+	m.cache.set(jti, revocationCacheEntry{revoked: true, userID: userID, until: expiry})
+	return nil
+}
+
+// RevokeAllForUser revokes every access token issued to a user until now.
+func (m *RevocationModel) RevokeAllForUser(userID int64) error {
+	query := `
+		UPDATE users
+		SET tokens_valid_after = $1
+		WHERE id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	m.cache.forgetUser(userID)
+	return nil
+}
+
+// IsRevoked reports whether an access token of a user, identified by its jti claim, was
+// revoked. Tokens issued before the user's TokensValidAfter are checked by the caller,
+// from the user record.
+func (m *RevocationModel) IsRevoked(jti string, userID int64) (bool, error) {
+	if revoked, ok := m.cache.get(jti); ok {
+		return revoked, nil
+	}
+
+	query := `
+		SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var revoked bool
+
+	err := m.DB.QueryRowContext(ctx, query, jti).Scan(&revoked)
+	if err != nil {
+		return false, err
+	}
+
+	m.cache.set(jti, revocationCacheEntry{revoked: revoked, userID: userID, until: time.Now().Add(revocationCacheTTL)})
+	return revoked, nil
+}
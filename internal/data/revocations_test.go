@@ -0,0 +1,37 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRevocationCache(t *testing.T) {
+	c := newRevocationCache()
+
+	if _, ok := c.get("a"); ok {
+		t.Fatal("empty cache: got an entry")
+	}
+
+	c.set("a", revocationCacheEntry{revoked: true, userID: 1, until: time.Now().Add(time.Hour)})
+	c.set("b", revocationCacheEntry{revoked: false, userID: 2, until: time.Now().Add(time.Hour)})
+	c.set("c", revocationCacheEntry{revoked: false, userID: 2, until: time.Now().Add(-time.Second)})
+
+	if revoked, ok := c.get("a"); !ok || !revoked {
+		t.Errorf("a: got revoked %t, cached %t; want revoked, cached", revoked, ok)
+	}
+	if revoked, ok := c.get("b"); !ok || revoked {
+		t.Errorf("b: got revoked %t, cached %t; want not revoked, cached", revoked, ok)
+	}
+	if _, ok := c.get("c"); ok {
+		t.Error("c: expired entry is still cached")
+	}
+
+	c.forgetUser(2)
+
+	if _, ok := c.get("b"); ok {
+		t.Error("b: entry of a forgotten user is still cached")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Error("a: entry of another user was forgotten")
+	}
+}
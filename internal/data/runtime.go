@@ -3,15 +3,46 @@ package data
 import (
 	"errors"
 	"fmt"
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
 )
 
 type Runtime int32
 
+// The forms a runtime can be written to JSON in.
+const (
+	RuntimeFormatMins    = "mins"    // "102 mins"
+	RuntimeFormatMinutes = "minutes" // 102
+	RuntimeFormatISO8601 = "iso8601" // "PT1H42M"
+)
+
+// RuntimeFormats lists the supported output forms of runtimes.
+var RuntimeFormats = []string{RuntimeFormatMins, RuntimeFormatMinutes, RuntimeFormatISO8601}
+
+// RuntimeFormat is the form runtimes are written to JSON in. It's a server option, set
+// once at startup, since MarshalJSON has no request to read it from.
+var RuntimeFormat = RuntimeFormatMins
+
 // MarshalJSON Implement Marshaler interface
 func (r Runtime) MarshalJSON() ([]byte, error) {
-	jsonValue := fmt.Sprintf("%d mins", r)
+	var jsonValue string
+
+	switch RuntimeFormat {
+	case RuntimeFormatMinutes:
+		return []byte(strconv.FormatInt(int64(r), 10)), nil
+	case RuntimeFormatISO8601:
+		jsonValue = "PT"
+		if hours := r / 60; hours != 0 {
+			jsonValue += fmt.Sprintf("%dH", hours)
+		}
+		if minutes := r % 60; minutes != 0 || r == 0 {
+			jsonValue += fmt.Sprintf("%dM", minutes)
+		}
+	default:
+		jsonValue = fmt.Sprintf("%d mins", r)
+	}
 
 	// Add double quotes
 	quotedJSONValue := strconv.Quote(jsonValue)
@@ -21,26 +52,82 @@ func (r Runtime) MarshalJSON() ([]byte, error) {
 
 var ErrInvalidRuntimeFormat = errors.New("invalid runtime format")
 
-func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
-	// expected "<runtime> mins" -> remove double-quotes
-	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
-	if err != nil {
-		return ErrInvalidRuntimeFormat
+var (
+	// runtimeHoursMinutesRX matches "102 mins", "102 min", "102m", "1h 42m" and "2 hours".
+	runtimeHoursMinutesRX = regexp.MustCompile(`^(?:(\d+)\s*h(?:ours?|rs?)?)?\s*(?:(\d+)\s*m(?:in(?:ute)?s?)?)?$`)
+
+	// runtimeISO8601RX matches ISO 8601 durations of hours, minutes and seconds, e.g. "PT1H42M".
+	runtimeISO8601RX = regexp.MustCompile(`^pt(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s)?$`)
+)
+
+// ParseRuntime reads a runtime written as a number of minutes, like "102", "102 mins" or
+// "102m", in hours and minutes, like "1h 42m", or as an ISO 8601 duration, like "PT1H42M".
+// ErrInvalidRuntimeFormat is returned for anything else, or for durations which aren't a
+// whole number of minutes.
+func ParseRuntime(s string) (Runtime, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	// A bare number keeps its sign, so a negative runtime is reported by validation
+	if i, err := strconv.ParseInt(s, 10, 32); err == nil {
+		return Runtime(i), nil
 	}
 
-	// Split get the number
-	parts := strings.Split(unquotedJSONValue, " ")
-	if len(parts) != 2 || parts[1] != "mins" {
+	var hours, minutes, seconds string
+
+	if matches := runtimeISO8601RX.FindStringSubmatch(s); matches != nil && s != "pt" {
+		hours, minutes, seconds = matches[1], matches[2], matches[3]
+	} else if matches := runtimeHoursMinutesRX.FindStringSubmatch(s); matches != nil && s != "" {
+		hours, minutes = matches[1], matches[2]
+	} else {
+		return 0, ErrInvalidRuntimeFormat
+	}
+
+	var total int64
+	for _, part := range []struct {
+		value   string
+		seconds int64
+	}{{hours, 3600}, {minutes, 60}, {seconds, 1}} {
+		if part.value == "" {
+			continue
+		}
+
+		n, err := strconv.ParseInt(part.value, 10, 32)
+		if err != nil {
+			return 0, ErrInvalidRuntimeFormat
+		}
+
+		total += n * part.seconds
+	}
+
+	if total%60 != 0 || total/60 > math.MaxInt32 {
+		return 0, ErrInvalidRuntimeFormat
+	}
+
+	return Runtime(total / 60), nil
+}
+
+// UnmarshalJSON accepts a number of minutes, or a string in any of the forms ParseRuntime
+// reads.
+func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
+	s := string(jsonValue)
+
+	// Strings are unquoted, bare numbers are parsed as they are
+	if strings.HasPrefix(s, `"`) {
+		unquotedJSONValue, err := strconv.Unquote(s)
+		if err != nil {
+			return ErrInvalidRuntimeFormat
+		}
+		s = unquotedJSONValue
+	} else if strings.ContainsAny(s, ".eE") {
 		return ErrInvalidRuntimeFormat
 	}
 
-	// parse strings into int32
-	i, err := strconv.ParseInt(parts[0], 10, 32)
+	runtime, err := ParseRuntime(s)
 	if err != nil {
 		return ErrInvalidRuntimeFormat
 	}
 
 	// Convert int32 -> Runtime type ( dereferencing )
-	*r = Runtime(i)
+	*r = runtime
 	return nil
 }
@@ -0,0 +1,80 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestRuntimeUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json string
+		want Runtime
+		err  error
+	}{
+		{`"102 mins"`, 102, nil},
+		{`"102 min"`, 102, nil},
+		{`"102 minutes"`, 102, nil},
+		{`"102m"`, 102, nil},
+		{`102`, 102, nil},
+		{`"102"`, 102, nil},
+		{`"1h 42m"`, 102, nil},
+		{`"1h42m"`, 102, nil},
+		{`"2 hours"`, 120, nil},
+		{`"PT1H42M"`, 102, nil},
+		{`"pt102m"`, 102, nil},
+		{`"PT2H"`, 120, nil},
+		{`"PT1H30M0S"`, 90, nil},
+		{`"PT6120S"`, 102, nil},
+		{`"PT1H42M30S"`, 0, ErrInvalidRuntimeFormat},
+		{`"PT"`, 0, ErrInvalidRuntimeFormat},
+		{`""`, 0, ErrInvalidRuntimeFormat},
+		{`"1h 42"`, 0, ErrInvalidRuntimeFormat},
+		{`"102 seconds"`, 0, ErrInvalidRuntimeFormat},
+		{`"mins"`, 0, ErrInvalidRuntimeFormat},
+		{`102.5`, 0, ErrInvalidRuntimeFormat},
+		{`true`, 0, ErrInvalidRuntimeFormat},
+		{`"99999999999 mins"`, 0, ErrInvalidRuntimeFormat},
+	}
+
+	for _, tt := range tests {
+		var got Runtime
+		err := json.Unmarshal([]byte(tt.json), &got)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("%s: got %d, %v; want %d, %v", tt.json, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestRuntimeMarshalJSON(t *testing.T) {
+	defer func(format string) { RuntimeFormat = format }(RuntimeFormat)
+
+	tests := []struct {
+		format  string
+		runtime Runtime
+		want    string
+	}{
+		{RuntimeFormatMins, 102, `"102 mins"`},
+		{RuntimeFormatMinutes, 102, `102`},
+		{RuntimeFormatISO8601, 102, `"PT1H42M"`},
+		{RuntimeFormatISO8601, 120, `"PT2H"`},
+		{RuntimeFormatISO8601, 45, `"PT45M"`},
+		{RuntimeFormatISO8601, 0, `"PT0M"`},
+	}
+
+	for _, tt := range tests {
+		RuntimeFormat = tt.format
+
+		got, err := json.Marshal(tt.runtime)
+		if err != nil || string(got) != tt.want {
+			t.Errorf("%s %d: got %s, %v; want %s", tt.format, tt.runtime, got, err, tt.want)
+			continue
+		}
+
+		// Every output form reads back as the same runtime
+		var parsed Runtime
+		if err = json.Unmarshal(got, &parsed); err != nil || parsed != tt.runtime {
+			t.Errorf("%s %d: read back %d, %v", tt.format, tt.runtime, parsed, err)
+		}
+	}
+}
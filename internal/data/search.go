@@ -0,0 +1,37 @@
+package data
+
+import (
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+)
+
+// SearchConfigs lists the PostgreSQL text-search configurations a search may use.
+var SearchConfigs = []string{
+	"simple", "danish", "dutch", "english", "finnish", "french", "german", "hungarian",
+	"italian", "norwegian", "portuguese", "romanian", "russian", "spanish", "swedish", "turkish",
+}
+
+// TextSearch is a ranked full-text search. Query uses websearch syntax: "quoted phrases",
+// -exclusions and OR. Config is the text-search configuration used for stemming. Fuzzy
+// also matches titles which are trigram-similar to the query, to tolerate typos.
+type TextSearch struct {
+	Query  string
+	Config string
+	Fuzzy  bool
+}
+
+func ValidateTextSearch(v *validation.Validator, s TextSearch) {
+	v.Check(len(s.Query) <= 500, "q", "must not be more than 500 bytes long")
+	v.Check(validation.PermittedValue(s.Config, SearchConfigs...), "search_config", "must be a supported text-search configuration")
+}
+
+// config returns the text-search configuration. It is written into the SQL as a literal
+// rather than bound as a parameter, so that the per-configuration expression indexes
+// can be used.
+func (s TextSearch) config() string {
+	if validation.PermittedValue(s.Config, SearchConfigs...) {
+		return s.Config
+	}
+
+	// Help prevent SQL injection.
+	panic("unsafe search config: " + s.Config)
+}
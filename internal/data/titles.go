@@ -0,0 +1,147 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// LocaleRX matches a lower-cased BCP 47 language tag, e.g. "fr" or "pt-br".
+var LocaleRX = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// Title is the alternate title of a movie in a locale.
+type Title struct {
+	MovieID   int64     `json:"-"`
+	Locale    string    `json:"locale" example:"fr"`
+	Title     string    `json:"title" example:"Panthère noire"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TitleModel struct which wrap a sql.DB connection pool
+type TitleModel struct {
+	DB *sql.DB
+}
+
+// NormalizeLocale returns the form locales are stored and matched in: lower-cased, with
+// hyphens as separators.
+func NormalizeLocale(locale string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(locale)), "_", "-")
+}
+
+func ValidateLocale(v *validation.Validator, key, locale string) {
+	v.Check(locale != "", key, "must be provided")
+	v.Check(len(locale) <= 35, key, "must not be more than 35 bytes long")
+	v.Check(validation.Matches(locale, LocaleRX), key, "must be a language tag such as fr or pt-BR")
+}
+
+func ValidateTitle(v *validation.Validator, title *Title) {
+	ValidateLocale(v, "locale", title.Locale)
+
+	v.Check(title.Title != "", "title", "must be provided")
+	v.Check(len(title.Title) <= 500, "title", "must not be more than 500 bytes long")
+}
+
+// Upsert sets the title of a movie in a locale, replacing any previous one. The movie
+// version is bumped, so that the ETag of its localized representation changes.
+func (m *TitleModel) Upsert(title *Title) error {
+	query := `
+		WITH title AS (
+			INSERT INTO movie_titles (movie_id, locale, title)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (movie_id, locale) DO UPDATE SET title = EXCLUDED.title
+			RETURNING movie_id, created_at
+		), touched AS (
+			UPDATE movies SET version = version + 1
+			WHERE id IN (SELECT movie_id FROM title)
+		)
+		SELECT created_at FROM title
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, title.MovieID, title.Locale, title.Title).Scan(&title.CreatedAt)
+}
+
+// GetForMovie returns the alternate titles of a movie ordered by locale.
+func (m *TitleModel) GetForMovie(movieID int64) ([]*Title, error) {
+	query := `
+		SELECT movie_id, locale, title, created_at
+		FROM movie_titles
+		WHERE movie_id = $1
+		ORDER BY locale
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	titles := []*Title{}
+	for rows.Next() {
+		var title Title
+
+		err = rows.Scan(&title.MovieID, &title.Locale, &title.Title, &title.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		titles = append(titles, &title)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return titles, nil
+}
+
+// Delete removes the title of a movie in a locale, bumping the movie version like Upsert.
+func (m *TitleModel) Delete(movieID int64, locale string) error {
+	query := `
+		WITH deleted AS (
+			DELETE FROM movie_titles
+			WHERE movie_id = $1 AND locale = $2
+			RETURNING movie_id
+		)
+		UPDATE movies SET version = version + 1
+		WHERE id IN (SELECT movie_id FROM deleted)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	results, err := m.DB.ExecContext(ctx, query, movieID, locale)
+	if err != nil {
+		return err
+	}
+
+	rowAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// localizedTitleExpr returns the SELECT expression of the title of a movie in the first of
+// the languages bound at the placeholder which it has a title in, or NULL.
+func localizedTitleExpr(placeholder int) string {
+	return fmt.Sprintf(`(
+		SELECT movie_titles.title FROM movie_titles
+		WHERE movie_titles.movie_id = movies.id AND movie_titles.locale = ANY($%[1]d)
+		ORDER BY array_position($%[1]d, movie_titles.locale)
+		LIMIT 1)`, placeholder)
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
 	"github.com/minhnghia2k3/greenlight/internal/validation"
 	"time"
 )
@@ -14,6 +15,11 @@ const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
 	ScopePasswordReset  = "password-reset"
+	ScopeRefresh        = "refresh"
+)
+
+var (
+	ErrRefreshTokenReused = errors.New("refresh token reused")
 )
 
 type Token struct {
@@ -22,6 +28,7 @@ type Token struct {
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	Family    []byte    `json:"-"` // shared by the refresh tokens issued from one sign-in
 }
 
 type TokenModel struct {
@@ -82,17 +89,18 @@ func ValidateTokenPlainText(v *validation.Validator, tokenPlainText string) {
 	v.Check(len(tokenPlainText) == 26, "token", "must be 26 bytes long")
 }
 
+// insertTokenQuery inserts a token. Only refresh tokens have a family.
+const insertTokenQuery = `INSERT INTO tokens(hash, user_id, expiry, scope, family)
+	VALUES($1, $2, $3, $4, NULLIF($5, ''::bytea))`
+
 // Insert adds the data for a specific token to the tokens table.
 func (m TokenModel) Insert(token *Token) error {
-	query := `INSERT INTO tokens(hash, user_id,expiry,scope)
-	VALUES($1, $2, $3, $4)`
-
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.Family}
 
-	_, err := m.DB.ExecContext(ctx, query, args...)
+	_, err := m.DB.ExecContext(ctx, insertTokenQuery, args...)
 	if err != nil {
 		return err
 	}
@@ -114,3 +122,121 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	}
 	return nil
 }
+
+// NewRefresh creates a refresh token starting a new token family, for a user who just
+// signed in.
+func (m TokenModel) NewRefresh(userID int64, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(userID, ttl, ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Family = make([]byte, 16)
+
+	_, err = rand.Read(token.Family)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.Insert(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Rotate exchanges a refresh token for a new one of the same family, and marks it used.
+// ErrRecordNotFound is returned for unknown or expired tokens. A used token being
+// presented again means it was stolen, by whoever presents it now or by whoever
+// rotated it before: the whole family is revoked and ErrRefreshTokenReused is returned.
+func (m TokenModel) Rotate(tokenPlainText string, ttl time.Duration) (*Token, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+
+	query := `
+		SELECT user_id, expiry, family, used_at IS NOT NULL
+		FROM tokens
+		WHERE hash = $1 AND scope = $2
+		FOR UPDATE
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		current Token
+		used    bool
+	)
+
+	err = tx.QueryRowContext(ctx, query, tokenHash[:], ScopeRefresh).Scan(&current.UserID, &current.Expiry, &current.Family, &used)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if used {
+		_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE family = $1`, current.Family)
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, ErrRefreshTokenReused
+	}
+
+	if !current.Expiry.After(time.Now()) {
+		return nil, ErrRecordNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE tokens SET used_at = NOW() WHERE hash = $1`, tokenHash[:])
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := generateToken(current.UserID, ttl, ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+	token.Family = current.Family
+
+	_, err = tx.ExecContext(ctx, insertTokenQuery, token.Hash, token.UserID, token.Expiry, token.Scope, token.Family)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// DeleteFamily revokes a refresh token of a user together with every other token issued
+// from the same sign-in.
+func (m TokenModel) DeleteFamily(tokenPlainText string, userID int64) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+
+	query := `DELETE FROM tokens
+	WHERE family = (SELECT family FROM tokens WHERE hash = $1 AND scope = $2 AND user_id = $3)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, tokenHash[:], ScopeRefresh, userID)
+	return err
+}
@@ -24,6 +24,9 @@ type User struct {
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
 	Version   int       `json:"version"`
+
+	// TokensValidAfter revokes the access tokens issued before it, e.g. on a password change
+	TokensValidAfter time.Time `json:"-"`
 }
 
 type password struct {
@@ -120,7 +123,7 @@ func (m UserModel) Insert(user *User) error {
 }
 
 func (m UserModel) GetByEmail(email string) (*User, error) {
-	query := `SELECT id, created_at, name, email, hashed_password,activated, version
+	query := `SELECT id, created_at, name, email, hashed_password,activated, version, tokens_valid_after
 FROM users
 WHERE email = $1`
 
@@ -136,6 +139,7 @@ WHERE email = $1`
 		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
+		&user.TokensValidAfter,
 	)
 	if err != nil {
 		switch {
@@ -191,7 +195,8 @@ func (m UserModel) GetForToken(scope string, tokenPlainText string) (*User, erro
 	tokenHash := sha256.Sum256([]byte(tokenPlainText)) // return an array with length 32
 
 	query := `
-	SELECT users.id, users.created_at, users.name, users.email, users.hashed_password, users.activated, users.version
+	SELECT users.id, users.created_at, users.name, users.email, users.hashed_password, users.activated, users.version,
+	       users.tokens_valid_after
 	FROM users
 	INNER JOIN tokens
 	ON users.id = tokens.user_id
@@ -211,6 +216,7 @@ func (m UserModel) GetForToken(scope string, tokenPlainText string) (*User, erro
 		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
+		&user.TokensValidAfter,
 	)
 	if err != nil {
 		switch {
@@ -227,7 +233,7 @@ func (m UserModel) GetForToken(scope string, tokenPlainText string) (*User, erro
 func (m UserModel) Get(userID int64) (*User, error) {
 	var user User
 	query := `
-	SELECT id, created_at, name, email, hashed_password, activated, version 
+	SELECT id, created_at, name, email, hashed_password, activated, version, tokens_valid_after
 	FROM users WHERE id = $1
 `
 
@@ -242,6 +248,7 @@ func (m UserModel) Get(userID int64) (*User, error) {
 		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
+		&user.TokensValidAfter,
 	)
 	if err != nil {
 		switch {
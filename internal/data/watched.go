@@ -0,0 +1,131 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/minhnghia2k3/greenlight/internal/validation"
+	"time"
+)
+
+// WatchedEntry records that a user watched a movie on a given date. A movie can be
+// logged more than once for rewatches.
+type WatchedEntry struct {
+	ID        int64     `json:"id"`
+	WatchedAt time.Time `json:"watched_at"`
+	Movie     *Movie    `json:"movie"`
+}
+
+// WatchedModel struct which wrap a sql.DB connection pool
+type WatchedModel struct {
+	DB *sql.DB
+}
+
+func ValidateWatchedEntry(v *validation.Validator, entry *WatchedEntry) {
+	v.Check(!entry.WatchedAt.IsZero(), "watched_at", "must be provided")
+	v.Check(entry.WatchedAt.Year() >= 1888, "watched_at", "must be after 1888")
+	v.Check(!entry.WatchedAt.After(time.Now()), "watched_at", "must not be in the future")
+}
+
+func (m *WatchedModel) Insert(userID int64, entry *WatchedEntry) error {
+	query := `
+		INSERT INTO watched_movies (user_id, movie_id, watched_at)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{userID, entry.Movie.ID, entry.WatchedAt}
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&entry.ID)
+}
+
+// GetAll returns a page of a user's watched history together with the watched movies.
+func (m *WatchedModel) GetAll(userID int64, filters Filters) ([]*WatchedEntry, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT COUNT(*) OVER(), watched_movies.id, watched_movies.watched_at,
+	       movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres, movies.version,
+	       movies.average_rating, movies.rating_count
+	FROM watched_movies
+	INNER JOIN movies ON movies.id = watched_movies.movie_id
+	WHERE watched_movies.user_id = $1 AND movies.deleted_at IS NULL
+	ORDER BY %s, watched_movies.id ASC
+	LIMIT $2 OFFSET $3`, filters.orderBy(""))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var totalRecords int
+	entries := []*WatchedEntry{}
+	for rows.Next() {
+		entry := WatchedEntry{Movie: &Movie{}}
+
+		err = rows.Scan(
+			&totalRecords,
+			&entry.ID,
+			&entry.WatchedAt,
+			&entry.Movie.ID,
+			&entry.Movie.CreatedAt,
+			&entry.Movie.Title,
+			&entry.Movie.Year,
+			&entry.Movie.Runtime,
+			pq.Array(&entry.Movie.Genres),
+			&entry.Movie.Version,
+			&entry.Movie.AverageRating,
+			&entry.Movie.RatingCount,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return entries, metadata, nil
+}
+
+// Delete removes an entry from a user's watched history. Entries of other users are
+// reported as not found.
+func (m *WatchedModel) Delete(userID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM watched_movies
+		WHERE id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	results, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,224 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"time"
+)
+
+var (
+	ErrDuplicateWatchlistItem = errors.New("duplicate watchlist item")
+)
+
+// WatchlistItem is a movie a user wants to watch, at a user-chosen position in their list.
+type WatchlistItem struct {
+	Position int32     `json:"position"`
+	AddedAt  time.Time `json:"added_at"`
+	Movie    *Movie    `json:"movie"`
+}
+
+// WatchlistModel struct which wrap a sql.DB connection pool
+type WatchlistModel struct {
+	DB *sql.DB
+}
+
+// Add appends a movie to the end of a user's watchlist.
+func (m *WatchlistModel) Add(userID int64, movie *Movie) (*WatchlistItem, error) {
+	query := `
+		INSERT INTO watchlist_items (user_id, movie_id, position)
+		SELECT $1, $2, COALESCE(MAX(position), 0) + 1 FROM watchlist_items WHERE user_id = $1
+		RETURNING position, added_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = lockWatchlist(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &WatchlistItem{Movie: movie}
+
+	err = tx.QueryRowContext(ctx, query, userID, movie.ID).Scan(&item.Position, &item.AddedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "watchlist_items_pkey"`:
+			return nil, ErrDuplicateWatchlistItem
+		default:
+			return nil, err
+		}
+	}
+
+	return item, tx.Commit()
+}
+
+// lockWatchlist serializes the changes to a user's watchlist, so that positions computed
+// from the current list stay unique. The user row is locked, as an empty list has no rows.
+func lockWatchlist(ctx context.Context, tx *sql.Tx, userID int64) error {
+	_, err := tx.ExecContext(ctx, `SELECT 1 FROM users WHERE id = $1 FOR NO KEY UPDATE`, userID)
+	return err
+}
+
+// GetAll returns a page of a user's watchlist together with the listed movies.
+func (m *WatchlistModel) GetAll(userID int64, filters Filters) ([]*WatchlistItem, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT COUNT(*) OVER(), watchlist_items.position, watchlist_items.added_at,
+	       movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres, movies.version,
+	       movies.average_rating, movies.rating_count
+	FROM watchlist_items
+	INNER JOIN movies ON movies.id = watchlist_items.movie_id
+	WHERE watchlist_items.user_id = $1 AND movies.deleted_at IS NULL
+	ORDER BY %s, movies.id ASC
+	LIMIT $2 OFFSET $3`, filters.orderBy(""))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var totalRecords int
+	items := []*WatchlistItem{}
+	for rows.Next() {
+		item := WatchlistItem{Movie: &Movie{}}
+
+		err = rows.Scan(
+			&totalRecords,
+			&item.Position,
+			&item.AddedAt,
+			&item.Movie.ID,
+			&item.Movie.CreatedAt,
+			&item.Movie.Title,
+			&item.Movie.Year,
+			&item.Movie.Runtime,
+			pq.Array(&item.Movie.Genres),
+			&item.Movie.Version,
+			&item.Movie.AverageRating,
+			&item.Movie.RatingCount,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		items = append(items, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return items, metadata, nil
+}
+
+// Move places a movie at a new position in a user's watchlist, shifting the movies in
+// between by one. Positions past the end of the list move the movie to the end.
+func (m *WatchlistModel) Move(userID, movieID int64, position int32) (int32, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = lockWatchlist(ctx, tx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Read the current position and the end of the list
+	var current, last int32
+	err = tx.QueryRowContext(ctx, `
+		SELECT position, (SELECT MAX(position) FROM watchlist_items WHERE user_id = $1)
+		FROM watchlist_items
+		WHERE user_id = $1 AND movie_id = $2
+		FOR UPDATE`, userID, movieID).Scan(&current, &last)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	position = min(max(position, 1), last)
+
+	switch {
+	case position > current:
+		_, err = tx.ExecContext(ctx, `
+			UPDATE watchlist_items SET position = position - 1
+			WHERE user_id = $1 AND position > $2 AND position <= $3`, userID, current, position)
+	case position < current:
+		_, err = tx.ExecContext(ctx, `
+			UPDATE watchlist_items SET position = position + 1
+			WHERE user_id = $1 AND position >= $2 AND position < $3`, userID, position, current)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE watchlist_items SET position = $3
+		WHERE user_id = $1 AND movie_id = $2`, userID, movieID, position)
+	if err != nil {
+		return 0, err
+	}
+
+	return position, tx.Commit()
+}
+
+// Remove takes a movie off a user's watchlist and closes the gap it leaves behind.
+func (m *WatchlistModel) Remove(userID, movieID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockWatchlist(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	var position int32
+	err = tx.QueryRowContext(ctx, `
+		DELETE FROM watchlist_items
+		WHERE user_id = $1 AND movie_id = $2
+		RETURNING position`, userID, movieID).Scan(&position)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE watchlist_items SET position = position - 1
+		WHERE user_id = $1 AND position > $2`, userID, position)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
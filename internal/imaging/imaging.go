@@ -0,0 +1,115 @@
+// Package imaging validates uploaded images and scales them down to thumbnails, using
+// only the standard library codecs: JPEG, PNG and GIF.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported image type")
+	ErrTooLarge        = errors.New("image dimensions too large")
+)
+
+// ContentTypes lists the image types which can be decoded.
+var ContentTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+// MaxPixels caps the dimensions of a decoded image, so that a small, highly compressed
+// file can't make the server allocate gigabytes.
+const MaxPixels = 40_000_000
+
+// Decode sniffs the type of an image from its content, checks its dimensions and decodes
+// it. It returns the image and its content type.
+func Decode(b []byte) (image.Image, string, error) {
+	contentType := http.DetectContentType(b)
+
+	supported := false
+	for _, t := range ContentTypes {
+		if contentType == t {
+			supported = true
+		}
+	}
+	if !supported {
+		return nil, "", ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return nil, "", ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return img, contentType, nil
+}
+
+// Thumbnail scales an image down to the given width, keeping its aspect ratio. Each
+// pixel of the thumbnail is the average of the pixels it covers in the source, which
+// avoids the aliasing of nearest-neighbour sampling. Images which are already narrower
+// are returned as they are.
+func Thumbnail(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	if width <= 0 || bounds.Dx() <= width {
+		return src
+	}
+
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+
+	// Converting once makes the pixels directly addressable, which is much faster than
+	// calling At for each of them.
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	srcW, srcH := rgba.Bounds().Dx(), rgba.Bounds().Dy()
+
+	for y := 0; y < height; y++ {
+		y0 := y * srcH / height
+		y1 := max((y+1)*srcH/height, y0+1)
+
+		for x := 0; x < width; x++ {
+			x0 := x * srcW / width
+			x1 := max((x+1)*srcW/width, x0+1)
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride+x0*4 : sy*rgba.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += uint32(row[i])
+					g += uint32(row[i+1])
+					b += uint32(row[i+2])
+					a += uint32(row[i+3])
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+// EncodeJPEG writes an image as a JPEG of the quality thumbnails are served at.
+func EncodeJPEG(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+}
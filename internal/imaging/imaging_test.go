@@ -0,0 +1,62 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestThumbnail(t *testing.T) {
+	// Left half black, right half white
+	src := image.NewRGBA(image.Rect(0, 0, 400, 600))
+	for y := 0; y < 600; y++ {
+		for x := 200; x < 400; x++ {
+			src.Set(x, y, color.White)
+		}
+	}
+
+	thumb := Thumbnail(src, 100)
+	if got := thumb.Bounds(); got.Dx() != 100 || got.Dy() != 150 {
+		t.Fatalf("got size %dx%d, want 100x150", got.Dx(), got.Dy())
+	}
+
+	if r, _, _, _ := thumb.At(10, 10).RGBA(); r != 0 {
+		t.Errorf("got left pixel red %d, want 0", r)
+	}
+	if r, _, _, _ := thumb.At(90, 10).RGBA(); r != 0xffff {
+		t.Errorf("got right pixel red %d, want %d", r, 0xffff)
+	}
+
+	if Thumbnail(src, 800) != image.Image(src) {
+		t.Error("narrower images should be returned as they are")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 10, 20)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, contentType, err := Decode(buf.Bytes())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if contentType != "image/png" || img.Bounds().Dy() != 20 {
+		t.Errorf("got %s %v", contentType, img.Bounds())
+	}
+
+	_, _, err = Decode([]byte("GIF89a? not really"))
+	if err == nil {
+		t.Error("expected an error for a truncated image")
+	}
+
+	_, _, err = Decode([]byte("<svg></svg>"))
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("got error %v, want %v", err, ErrUnsupportedType)
+	}
+}
@@ -0,0 +1,265 @@
+// Package jsonpatch applies RFC 7396 JSON Merge Patches and RFC 6902 JSON Patches to
+// documents decoded by encoding/json into any.
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrTestFailed = errors.New("test operation failed")
+	ErrInvalidOp  = errors.New("invalid operation")
+	ErrPath       = errors.New("path not found")
+)
+
+// Operation is a single JSON Patch operation. Only the add, remove, replace and test
+// operations are supported.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// MergePatch applies a JSON Merge Patch to doc. Members of patch set to null are removed,
+// objects are merged recursively, and any other value replaces the target. doc may be
+// modified in place.
+func MergePatch(doc, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	docObject, ok := doc.(map[string]any)
+	if !ok {
+		docObject = make(map[string]any)
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(docObject, key)
+			continue
+		}
+		docObject[key] = MergePatch(docObject[key], value)
+	}
+
+	return docObject
+}
+
+// Apply applies the operations of a JSON Patch to doc in order. If any operation fails
+// the patch as a whole fails. doc may be modified in place.
+func Apply(doc any, ops []Operation) (any, error) {
+	for i, op := range ops {
+		var err error
+
+		doc, err = apply(doc, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	return doc, nil
+}
+
+func apply(doc any, op Operation) (any, error) {
+	tokens, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, tokens, value)
+	case "remove":
+		return remove(doc, tokens)
+	case "replace":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		if len(tokens) == 0 {
+			return value, nil
+		}
+		doc, err = remove(doc, tokens)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, tokens, value)
+	case "test":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		current, err := get(doc, tokens)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported op %q", ErrInvalidOp, op.Op)
+	}
+}
+
+func (op Operation) value() (any, error) {
+	if len(op.Value) == 0 {
+		return nil, fmt.Errorf("%w: missing value", ErrInvalidOp)
+	}
+
+	var value any
+	err := json.Unmarshal(op.Value, &value)
+	return value, err
+}
+
+// parsePointer splits a JSON Pointer into its unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: path must be empty or start with /", ErrInvalidOp)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	return tokens, nil
+}
+
+// arrayIndex parses an array index token. With end set, "-" and len(array) are accepted
+// as the position after the last element.
+func arrayIndex(token string, array []any, end bool) (int, error) {
+	if end && token == "-" {
+		return len(array), nil
+	}
+
+	// Leading zeros and signs aren't allowed.
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.IndexFunc(token, func(r rune) bool { return r < '0' || r > '9' }) != -1 {
+		return 0, ErrPath
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, ErrPath
+	}
+
+	if i > len(array) || (i == len(array) && !end) {
+		return 0, ErrPath
+	}
+
+	return i, nil
+}
+
+func get(doc any, tokens []string) (any, error) {
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, ErrPath
+			}
+			doc = value
+		case []any:
+			i, err := arrayIndex(token, node, false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, ErrPath
+		}
+	}
+
+	return doc, nil
+}
+
+// modify calls fn with the parent of the location referenced by tokens and the last
+// token, and stores the parent returned by fn in its own parent.
+func modify(doc any, tokens []string, fn func(parent any, token string) (any, error)) (any, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+
+	child, err := get(doc, tokens[:1])
+	if err != nil {
+		return nil, err
+	}
+
+	child, err = modify(child, tokens[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch node := doc.(type) {
+	case map[string]any:
+		node[tokens[0]] = child
+	case []any:
+		i, _ := arrayIndex(tokens[0], node, false)
+		node[i] = child
+	}
+
+	return doc, nil
+}
+
+func add(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	return modify(doc, tokens, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			node[token] = value
+			return node, nil
+		case []any:
+			i, err := arrayIndex(token, node, true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		default:
+			return nil, ErrPath
+		}
+	})
+}
+
+func remove(doc any, tokens []string) (any, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: the whole document can't be removed", ErrInvalidOp)
+	}
+
+	return modify(doc, tokens, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			if _, ok := node[token]; !ok {
+				return nil, ErrPath
+			}
+			delete(node, token)
+			return node, nil
+		case []any:
+			i, err := arrayIndex(token, node, false)
+			if err != nil {
+				return nil, err
+			}
+			return append(node[:i], node[i+1:]...), nil
+		default:
+			return nil, ErrPath
+		}
+	})
+}
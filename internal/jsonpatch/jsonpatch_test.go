@@ -0,0 +1,82 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func decode(t *testing.T, s string) any {
+	t.Helper()
+
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("decoding %s: %v", s, err)
+	}
+	return v
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":["b"]}`, `{"a":["c","d"]}`, `{"a":["c","d"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`["a"]`, `{"a":"b"}`, `{"a":"b"}`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+	}
+
+	for _, tt := range tests {
+		got := MergePatch(decode(t, tt.doc), decode(t, tt.patch))
+		if !reflect.DeepEqual(got, decode(t, tt.want)) {
+			t.Errorf("MergePatch(%s, %s) = %v, want %s", tt.doc, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		doc, patch, want string
+		err              error
+	}{
+		{`{"genres":["a","b"]}`, `[{"op":"add","path":"/genres/1","value":"c"}]`, `{"genres":["a","c","b"]}`, nil},
+		{`{"genres":["a","b"]}`, `[{"op":"add","path":"/genres/-","value":"c"}]`, `{"genres":["a","b","c"]}`, nil},
+		{`{"genres":["a","b"]}`, `[{"op":"remove","path":"/genres/0"}]`, `{"genres":["b"]}`, nil},
+		{`{"genres":["a","b"]}`, `[{"op":"replace","path":"/genres/1","value":"c"}]`, `{"genres":["a","c"]}`, nil},
+		{`{"title":"a"}`, `[{"op":"test","path":"/title","value":"a"},{"op":"replace","path":"/title","value":"b"}]`, `{"title":"b"}`, nil},
+		{`{"a/b":{"~":1}}`, `[{"op":"replace","path":"/a~1b/~0","value":2}]`, `{"a/b":{"~":2}}`, nil},
+		{`{"title":"a"}`, `[{"op":"test","path":"/title","value":"b"}]`, ``, ErrTestFailed},
+		{`{"title":"a"}`, `[{"op":"remove","path":"/year"}]`, ``, ErrPath},
+		{`{"genres":["a"]}`, `[{"op":"replace","path":"/genres/01","value":"b"}]`, ``, ErrPath},
+		{`{"genres":["a"]}`, `[{"op":"add","path":"/genres/2","value":"b"}]`, ``, ErrPath},
+		{`{"title":"a"}`, `[{"op":"move","path":"/title"}]`, ``, ErrInvalidOp},
+		{`{"title":"a"}`, `[{"op":"add","path":"/year"}]`, ``, ErrInvalidOp},
+	}
+
+	for _, tt := range tests {
+		var ops []Operation
+		if err := json.Unmarshal([]byte(tt.patch), &ops); err != nil {
+			t.Fatalf("decoding %s: %v", tt.patch, err)
+		}
+
+		got, err := Apply(decode(t, tt.doc), ops)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Apply(%s, %s): got error %v, want %v", tt.doc, tt.patch, err, tt.err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Apply(%s, %s): unexpected error: %v", tt.doc, tt.patch, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, decode(t, tt.want)) {
+			t.Errorf("Apply(%s, %s) = %v, want %s", tt.doc, tt.patch, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,457 @@
+// Package jwtkeys holds the keys JWTs are signed and checked with. Each key is identified
+// by a key ID, written in the "kid" header of the tokens it signs, so that several keys
+// can be trusted at once and the signing key can be rotated without logging everyone out.
+//
+// Keys are loaded from a directory with one file per key, named after its key ID:
+//
+//   - <kid>.pem holds a PEM encoded RSA, ECDSA (P-256, P-384 or P-521) or Ed25519 key. A
+//     private key signs and checks tokens, a public key only checks them.
+//   - <kid>.secret holds an HMAC secret of at least 32 bytes.
+//
+// A key is rotated in three steps. Add the new key, then make it the active key once every
+// server and client trusts it, and finally remove the old key once the tokens it signed
+// have expired.
+package jwtkeys
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/pascaldekloe/jwt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DefaultKeyID identifies the secret given on the command line. Tokens without a key ID
+// are checked with it, since they were signed before keys had one.
+const DefaultKeyID = "default"
+
+// minSecretLength is the minimum length of HMAC secrets read from key files.
+const minSecretLength = 32
+
+// minRSABits is the minimum size of RSA keys.
+const minRSABits = 2048
+
+var (
+	ErrUnknownKey   = errors.New("unknown signing key")
+	ErrNoSigningKey = errors.New("no signing key")
+)
+
+// Key is a key tokens are signed or checked with.
+type Key struct {
+	ID        string
+	Algorithm string
+
+	// secret is set for HMAC keys, signer for private keys and public for every other key.
+	secret []byte
+	signer any
+	public any
+}
+
+// CanSign reports whether tokens can be signed with the key.
+func (k *Key) CanSign() bool {
+	return k.secret != nil || k.signer != nil
+}
+
+// KeySet is the set of trusted keys, one of which is the active key tokens are signed
+// with. It's safe for concurrent use and can be reloaded while in use.
+type KeySet struct {
+	dir      string
+	activeID string
+	secret   []byte
+
+	mu     sync.RWMutex
+	keys   map[string]*Key
+	active *Key
+}
+
+// Load returns the keys of dir, plus the secret under DefaultKeyID when it isn't empty.
+// Either can be left out, but not both. Tokens are signed with the key activeID, or when
+// it's empty with the signing key whose ID sorts last, so that keys named by date are
+// picked up as they're added.
+func Load(dir, activeID string, secret []byte) (*KeySet, error) {
+	s := &KeySet{dir: dir, activeID: activeID, secret: secret}
+
+	err := s.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Reload reads the keys again, to rotate them without a restart. On error the keys in use
+// are kept.
+func (s *KeySet) Reload() error {
+	keys := make(map[string]*Key)
+
+	if len(s.secret) != 0 {
+		keys[DefaultKeyID] = &Key{ID: DefaultKeyID, Algorithm: jwt.HS256, secret: s.secret}
+	}
+
+	if s.dir != "" {
+		entries, err := os.ReadDir(s.dir)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || (ext != ".pem" && ext != ".secret") {
+				continue
+			}
+
+			id := strings.TrimSuffix(entry.Name(), ext)
+			if _, exists := keys[id]; exists {
+				return fmt.Errorf("jwt key %q: duplicate key ID", id)
+			}
+
+			text, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+			if err != nil {
+				return err
+			}
+
+			var key *Key
+
+			switch ext {
+			case ".pem":
+				key, err = parsePEM(id, text)
+			case ".secret":
+				key, err = parseSecret(id, text)
+			}
+			if err != nil {
+				return fmt.Errorf("jwt key %q: %w", id, err)
+			}
+
+			keys[id] = key
+		}
+	}
+
+	active, err := activeKey(keys, s.activeID)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = keys
+	s.active = active
+	return nil
+}
+
+// activeKey returns the key tokens are signed with.
+func activeKey(keys map[string]*Key, activeID string) (*Key, error) {
+	if activeID != "" {
+		key, ok := keys[activeID]
+		if !ok {
+			return nil, fmt.Errorf("active jwt key %q: %w", activeID, ErrUnknownKey)
+		}
+
+		if !key.CanSign() {
+			return nil, fmt.Errorf("active jwt key %q is a public key: %w", activeID, ErrNoSigningKey)
+		}
+
+		return key, nil
+	}
+
+	var active *Key
+
+	for _, key := range keys {
+		if !key.CanSign() {
+			continue
+		}
+
+		// The command line secret only signs when there is no other signing key
+		switch {
+		case active == nil:
+		case key.ID == DefaultKeyID:
+			continue
+		case active.ID != DefaultKeyID && key.ID < active.ID:
+			continue
+		}
+
+		active = key
+	}
+
+	if active == nil {
+		return nil, ErrNoSigningKey
+	}
+
+	return active, nil
+}
+
+// parsePEM reads the single key of a PEM file.
+func parsePEM(id string, text []byte) (*Key, error) {
+	var key *Key
+
+	for {
+		block, rest := pem.Decode(text)
+		if block == nil {
+			break
+		}
+		text = rest
+
+		var (
+			parsed any
+			err    error
+		)
+
+		switch block.Type {
+		case "EC PARAMETERS":
+			// Written by openssl ecparam along with the key
+			continue
+		case "PRIVATE KEY":
+			parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			parsed, err = x509.ParseECPrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "PUBLIC KEY":
+			parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+		default:
+			return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if key != nil {
+			return nil, errors.New("more than one key in file")
+		}
+
+		key, err = newKey(id, parsed)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if key == nil {
+		return nil, errors.New("no PEM encoded key in file")
+	}
+
+	return key, nil
+}
+
+// parseSecret reads an HMAC secret. Surrounding whitespace, like a trailing newline, isn't
+// part of the secret.
+func parseSecret(id string, text []byte) (*Key, error) {
+	secret := bytes.TrimSpace(text)
+	if len(secret) < minSecretLength {
+		return nil, fmt.Errorf("secret must be at least %d bytes long", minSecretLength)
+	}
+
+	return &Key{ID: id, Algorithm: jwt.HS256, secret: secret}, nil
+}
+
+// newKey returns the Key of a parsed private or public key, with the algorithm it's used
+// with.
+func newKey(id string, parsed any) (*Key, error) {
+	key := &Key{ID: id}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.signer, key.public = k, &k.PublicKey
+	case *ecdsa.PrivateKey:
+		key.signer, key.public = k, &k.PublicKey
+	case ed25519.PrivateKey:
+		key.signer, key.public = k, k.Public()
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		key.public = k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	switch k := key.public.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA key must be at least %d bits", minRSABits)
+		}
+		key.Algorithm = jwt.RS256
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			key.Algorithm = jwt.ES256
+		case elliptic.P384():
+			key.Algorithm = jwt.ES384
+		case elliptic.P521():
+			key.Algorithm = jwt.ES512
+		default:
+			return nil, fmt.Errorf("unsupported elliptic curve %s", k.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		key.Algorithm = jwt.EdDSA
+	}
+
+	return key, nil
+}
+
+// Active returns the key tokens are signed with.
+func (s *KeySet) Active() *Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.active
+}
+
+// Len returns the number of trusted keys.
+func (s *KeySet) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.keys)
+}
+
+// Sign signs claims with the active key, and sets their KeyID to it.
+func (s *KeySet) Sign(claims *jwt.Claims) ([]byte, error) {
+	key := s.Active()
+	claims.KeyID = key.ID
+
+	switch k := key.signer.(type) {
+	case *rsa.PrivateKey:
+		return claims.RSASign(key.Algorithm, k)
+	case *ecdsa.PrivateKey:
+		return claims.ECDSASign(key.Algorithm, k)
+	case ed25519.PrivateKey:
+		return claims.EdDSASign(k)
+	default:
+		return claims.HMACSign(key.Algorithm, key.secret)
+	}
+}
+
+// Check parses a token if, and only if, it's signed by a trusted key with the algorithm of
+// that key. ErrUnknownKey is returned for tokens of other keys. Use Claims.Valid to
+// complete the verification.
+func (s *KeySet) Check(token []byte) (*jwt.Claims, error) {
+	header, err := parseHeader(token)
+	if err != nil {
+		return nil, err
+	}
+
+	id := header.Kid
+	if id == "" {
+		id = DefaultKeyID
+	}
+
+	s.mu.RLock()
+	key, ok := s.keys[id]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	// Never let the token choose the algorithm, e.g. HMAC with a public key as secret
+	if header.Alg != key.Algorithm {
+		return nil, jwt.AlgError(header.Alg)
+	}
+
+	switch k := key.public.(type) {
+	case *rsa.PublicKey:
+		return jwt.RSACheck(token, k)
+	case *ecdsa.PublicKey:
+		return jwt.ECDSACheck(token, k)
+	case ed25519.PublicKey:
+		return jwt.EdDSACheck(token, k)
+	default:
+		return jwt.HMACCheck(token, key.secret)
+	}
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// parseHeader decodes the JOSE header of a token, without checking it.
+func parseHeader(token []byte) (*header, error) {
+	encoded, _, ok := bytes.Cut(token, []byte("."))
+	if !ok {
+		return nil, errors.New("jwt: malformed token")
+	}
+
+	text := make([]byte, base64.RawURLEncoding.DecodedLen(len(encoded)))
+
+	n, err := base64.RawURLEncoding.Decode(text, encoded)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: malformed JOSE header: %w", err)
+	}
+
+	var h header
+
+	err = json.Unmarshal(text[:n], &h)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: malformed JOSE header: %w", err)
+	}
+
+	return &h, nil
+}
+
+// JWK is the public part of a key, as a JSON Web Key (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Curve     string `json:"crv,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JWKS returns the public keys of the set, ordered by key ID, for other services to check
+// tokens with. HMAC keys are secret, so they're left out.
+func (s *KeySet) JWKS() []JWK {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jwks := []JWK{}
+
+	for _, key := range s.keys {
+		jwk := JWK{Use: "sig", Algorithm: key.Algorithm, KeyID: key.ID}
+
+		switch k := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = encode(k.N.Bytes())
+			jwk.E = encode(big.NewInt(int64(k.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (k.Curve.Params().BitSize + 7) / 8
+			jwk.KeyType = "EC"
+			jwk.Curve = k.Curve.Params().Name
+			jwk.X = encode(k.X.FillBytes(make([]byte, size)))
+			jwk.Y = encode(k.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = encode(k)
+		default:
+			continue
+		}
+
+		jwks = append(jwks, jwk)
+	}
+
+	slices.SortFunc(jwks, func(a, b JWK) int {
+		return strings.Compare(a.KeyID, b.KeyID)
+	})
+
+	return jwks
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
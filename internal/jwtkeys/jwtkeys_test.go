@@ -0,0 +1,203 @@
+package jwtkeys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"github.com/pascaldekloe/jwt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeKey(t *testing.T, dir, name string, key any) {
+	t.Helper()
+
+	var block *pem.Block
+
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	default:
+		der, err := x509.MarshalPKCS8PrivateKey(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+
+	err := os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeySet(t *testing.T) {
+	dir := t.TempDir()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeKey(t, dir, "2024-01.pem", rsaKey)
+	writeKey(t, dir, "2024-02.pem", ecKey)
+	writeKey(t, dir, "2024-03.pem", edKey)
+	// A key which is trusted but doesn't sign, like the next key before it's activated
+	writeKey(t, dir, "2024-04.pem", edPublic)
+	err = os.WriteFile(filepath.Join(dir, "hmac.secret"), []byte(strings.Repeat("s", 32)+"\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret := []byte("command line secret")
+
+	keys, err := Load(dir, "", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without an active key ID the signing key sorting last is used
+	if got := keys.Active().ID; got != "hmac" {
+		t.Errorf("active key: got %q, want %q", got, "hmac")
+	}
+
+	for _, id := range []string{DefaultKeyID, "2024-01", "2024-02", "2024-03", "hmac"} {
+		keys, err := Load(dir, id, secret)
+		if err != nil {
+			t.Fatalf("%s: %v", id, err)
+		}
+
+		var claims jwt.Claims
+		claims.Subject = "42"
+
+		token, err := keys.Sign(&claims)
+		if err != nil {
+			t.Fatalf("%s: sign: %v", id, err)
+		}
+
+		got, err := keys.Check(token)
+		if err != nil {
+			t.Fatalf("%s: check: %v", id, err)
+		}
+		if got.Subject != "42" || got.KeyID != id {
+			t.Errorf("%s: got subject %q and key ID %q", id, got.Subject, got.KeyID)
+		}
+	}
+
+	_, err = Load(dir, "2024-04", secret)
+	if !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("public key activated: got error %v, want %v", err, ErrNoSigningKey)
+	}
+
+	// Tokens signed before key IDs are checked with the command line secret
+	var claims jwt.Claims
+	claims.Subject = "42"
+
+	token, err := claims.HMACSign(jwt.HS256, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Check(token); err != nil {
+		t.Errorf("token without key ID: %v", err)
+	}
+
+	// The public key of an RSA key mustn't be usable as an HMAC secret
+	claims.KeyID = "2024-01"
+
+	token, err = claims.HMACSign(jwt.HS256, x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Check(token); err == nil {
+		t.Error("HS256 token checked with an RSA key")
+	}
+
+	// Tokens of removed keys are rejected once the keys are reloaded
+	claims.KeyID = ""
+
+	token, err = keys.Sign(&claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Remove(filepath.Join(dir, "hmac.secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = keys.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := keys.Check(token); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("token of a removed key: got error %v, want %v", err, ErrUnknownKey)
+	}
+	if got := keys.Active().ID; got != "2024-03" {
+		t.Errorf("active key after reload: got %q, want %q", got, "2024-03")
+	}
+
+	var ids []string
+	for _, jwk := range keys.JWKS() {
+		ids = append(ids, jwk.KeyID+":"+jwk.KeyType+":"+jwk.Algorithm)
+	}
+
+	want := "2024-01:RSA:RS256 2024-02:EC:ES256 2024-03:OKP:EdDSA 2024-04:OKP:EdDSA"
+	if got := strings.Join(ids, " "); got != want {
+		t.Errorf("JWKS: got %q, want %q", got, want)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		text string
+	}{
+		{"short secret", "a.secret", "too short"},
+		{"not PEM", "a.pem", "not a key"},
+		{"unsupported PEM block", "a.pem", "-----BEGIN CERTIFICATE REQUEST-----\n-----END CERTIFICATE REQUEST-----\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			err := os.WriteFile(filepath.Join(dir, tt.file), []byte(tt.text), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := Load(dir, "", []byte("secret")); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+
+	if _, err := Load("", "", nil); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("no keys: got error %v, want %v", err, ErrNoSigningKey)
+	}
+}
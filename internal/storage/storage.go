@@ -0,0 +1,35 @@
+// Package storage keeps uploaded files behind a small interface, so that the backend they
+// are stored in can be swapped.
+package storage
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("object not found")
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+// Object is a stored file opened for reading. It can be served with http.ServeContent,
+// which handles Range and conditional requests.
+type Object interface {
+	io.ReadSeekCloser
+	ModTime() time.Time
+}
+
+// Storage stores files under slash-separated keys such as "movies/1/poster/original".
+type Storage interface {
+	// Put stores the contents of r under key, replacing any existing object. Readers never
+	// see a partly written object.
+	Put(key string, r io.Reader) error
+
+	// Open returns the object stored under key, or ErrNotFound.
+	Open(key string) (Object, error)
+
+	// DeleteAll removes the objects whose keys are below prefix. Deleting a prefix without
+	// objects isn't an error.
+	DeleteAll(prefix string) error
+}
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS reviews
+(
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    movie_id   BIGINT                      NOT NULL REFERENCES movies (id) ON DELETE CASCADE,
+    user_id    BIGINT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    rating     INTEGER                     NOT NULL CHECK (rating BETWEEN 1 AND 10),
+    body       TEXT                        NOT NULL DEFAULT '',
+    version    INTEGER                     NOT NULL DEFAULT 1,
+    UNIQUE (movie_id, user_id) -- one review per user per movie
+);
+
+-- Aggregates are kept on the movie row so listings can sort by them without
+-- scanning the reviews table.
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS average_rating NUMERIC(4, 2) NOT NULL DEFAULT 0;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating_count INTEGER NOT NULL DEFAULT 0;
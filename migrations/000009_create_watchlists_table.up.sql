@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS watchlist_items
+(
+    user_id  BIGINT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    movie_id BIGINT                      NOT NULL REFERENCES movies (id) ON DELETE CASCADE,
+    position INTEGER                     NOT NULL,
+    added_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, movie_id) -- a movie can only be on a watchlist once
+);
+
+CREATE TABLE IF NOT EXISTS watched_movies
+(
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    movie_id   BIGINT                      NOT NULL REFERENCES movies (id) ON DELETE CASCADE,
+    watched_at DATE                        NOT NULL DEFAULT CURRENT_DATE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS watched_movies_user_idx ON watched_movies (user_id, watched_at);
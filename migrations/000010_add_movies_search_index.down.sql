@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS movies_search_simple_idx;
+DROP INDEX IF EXISTS movies_search_english_idx;
+DROP FUNCTION IF EXISTS movies_search_document(regconfig, TEXT, TEXT[]);
@@ -0,0 +1,15 @@
+-- The searchable document of a movie: the title weighted above the genres.
+-- array_to_string() is only STABLE, but the text output of a TEXT[] never changes,
+-- so the wrapper can be declared IMMUTABLE and used in expression indexes.
+CREATE OR REPLACE FUNCTION movies_search_document(config regconfig, title TEXT, genres TEXT[])
+    RETURNS tsvector
+    LANGUAGE sql
+    IMMUTABLE
+AS
+$$
+SELECT setweight(to_tsvector(config, title), 'A') || setweight(to_tsvector(config, array_to_string(genres, ' ')), 'B')
+$$;
+
+-- One index per text-search configuration a deployment is expected to search with.
+CREATE INDEX IF NOT EXISTS movies_search_simple_idx ON movies USING GIN (movies_search_document('simple', title, genres));
+CREATE INDEX IF NOT EXISTS movies_search_english_idx ON movies USING GIN (movies_search_document('english', title, genres));
@@ -0,0 +1,7 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP(0) WITH TIME ZONE;
+
+-- The trash listing and the purge only ever look at deleted movies.
+CREATE INDEX IF NOT EXISTS movies_deleted_at_idx ON movies (deleted_at) WHERE deleted_at IS NOT NULL;
+
+INSERT INTO permissions (code)
+VALUES ('movie:admin');
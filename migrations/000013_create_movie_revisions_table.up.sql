@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS movie_revisions
+(
+    id         BIGSERIAL PRIMARY KEY,
+    movie_id   BIGINT                      NOT NULL REFERENCES movies (id) ON DELETE CASCADE,
+    version    INTEGER                     NOT NULL,
+    operation  TEXT                        NOT NULL,
+    user_id    BIGINT                      REFERENCES users (id) ON DELETE SET NULL, -- keep the history when a user is deleted
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    snapshot   JSONB                       NOT NULL, -- the movie as it was after the change
+    diff       JSONB                       NOT NULL DEFAULT '{}',
+    UNIQUE (movie_id, version)
+);
+
+-- Record the current state of existing movies, so that they can be reverted to it.
+INSERT INTO movie_revisions (movie_id, version, operation, snapshot)
+SELECT id,
+       version,
+       'snapshot',
+       json_build_object('title', title, 'year', year, 'runtime', runtime || ' mins', 'genres', genres)
+FROM movies;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS movie_import_errors;
+DROP TABLE IF EXISTS movie_imports;
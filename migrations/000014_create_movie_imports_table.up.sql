@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS movie_imports
+(
+    id            BIGSERIAL PRIMARY KEY,
+    user_id       BIGINT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    format        TEXT                        NOT NULL,
+    status        TEXT                        NOT NULL DEFAULT 'pending',
+    total_rows    INTEGER                     NOT NULL DEFAULT 0,
+    inserted_rows INTEGER                     NOT NULL DEFAULT 0,
+    failed_rows   INTEGER                     NOT NULL DEFAULT 0,
+    error         TEXT                        NOT NULL DEFAULT '', -- why a failed import stopped
+    created_at    TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_at   TIMESTAMP(0) WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS movie_import_errors
+(
+    import_id  BIGINT  NOT NULL REFERENCES movie_imports (id) ON DELETE CASCADE,
+    row_number INTEGER NOT NULL,
+    errors     JSONB   NOT NULL,
+    PRIMARY KEY (import_id, row_number)
+);
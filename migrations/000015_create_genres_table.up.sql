@@ -0,0 +1,97 @@
+CREATE TABLE IF NOT EXISTS genres
+(
+    slug       TEXT PRIMARY KEY, -- the canonical spelling stored in movies.genres
+    name       TEXT                        NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    version    INTEGER                     NOT NULL DEFAULT 1
+);
+
+-- Other spellings of a genre, lower-cased, which are resolved to its slug.
+CREATE TABLE IF NOT EXISTS genre_aliases
+(
+    alias TEXT PRIMARY KEY,
+    slug  TEXT NOT NULL REFERENCES genres (slug) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS genre_aliases_slug_idx ON genre_aliases (slug);
+
+INSERT INTO genres (slug, name)
+VALUES ('action', 'Action'),
+       ('adventure', 'Adventure'),
+       ('animation', 'Animation'),
+       ('comedy', 'Comedy'),
+       ('crime', 'Crime'),
+       ('documentary', 'Documentary'),
+       ('drama', 'Drama'),
+       ('family', 'Family'),
+       ('fantasy', 'Fantasy'),
+       ('history', 'History'),
+       ('horror', 'Horror'),
+       ('musical', 'Musical'),
+       ('mystery', 'Mystery'),
+       ('romance', 'Romance'),
+       ('sci-fi', 'Science Fiction'),
+       ('thriller', 'Thriller'),
+       ('war', 'War'),
+       ('western', 'Western')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO genre_aliases (alias, slug)
+VALUES ('science fiction', 'sci-fi'),
+       ('science-fiction', 'sci-fi'),
+       ('scifi', 'sci-fi'),
+       ('sf', 'sci-fi'),
+       ('animated', 'animation'),
+       ('historical', 'history'),
+       ('documentaries', 'documentary')
+ON CONFLICT DO NOTHING;
+
+-- Spellings in use which don't match a genre or alias become genres of their own, keyed
+-- by their slugified form.
+INSERT INTO genres (slug, name)
+SELECT DISTINCT ON (used.slugified) used.slugified, initcap(used.spelling)
+FROM (SELECT lower(trim(genre))                                                        AS spelling,
+             trim(BOTH '-' FROM regexp_replace(lower(trim(genre)), '[^a-z0-9]+', '-', 'g')) AS slugified
+      FROM movies,
+           unnest(genres) AS genre) AS used
+WHERE used.slugified <> ''
+  AND NOT EXISTS (SELECT 1 FROM genres WHERE slug IN (used.spelling, used.slugified))
+  AND NOT EXISTS (SELECT 1 FROM genre_aliases WHERE alias IN (used.spelling, used.slugified))
+ORDER BY used.slugified, used.spelling
+ON CONFLICT DO NOTHING;
+
+-- Rewrite the genres of existing movies to the canonical slugs, dropping the duplicates
+-- this creates, and record the change as a new revision.
+WITH spellings AS (SELECT DISTINCT genre                                                                          AS spelling,
+                                   lower(trim(genre))                                                             AS lowered,
+                                   trim(BOTH '-' FROM regexp_replace(lower(trim(genre)), '[^a-z0-9]+', '-', 'g')) AS slugified
+                   FROM movies,
+                        unnest(genres) AS genre),
+     resolved AS (SELECT spelling,
+                         COALESCE((SELECT slug FROM genres WHERE slug IN (lowered, slugified) LIMIT 1),
+                                  (SELECT slug FROM genre_aliases WHERE alias IN (lowered, slugified) LIMIT 1),
+                                  spelling) AS slug
+                  FROM spellings),
+     normalised AS (SELECT movies.id,
+                           movies.genres AS old_genres,
+                           ARRAY(SELECT canonical.slug
+                                 FROM (SELECT DISTINCT ON (resolved.slug) resolved.slug, g.position
+                                       FROM unnest(movies.genres) WITH ORDINALITY AS g(genre, position)
+                                                INNER JOIN resolved ON resolved.spelling = g.genre
+                                       ORDER BY resolved.slug, g.position) AS canonical
+                                 ORDER BY canonical.position) AS genres
+                    FROM movies),
+     updated AS (
+         UPDATE movies
+             SET genres = normalised.genres, version = movies.version + 1
+             FROM normalised
+             WHERE movies.id = normalised.id AND movies.genres <> normalised.genres
+             RETURNING movies.id, movies.version, movies.title, movies.year, movies.runtime, movies.genres, normalised.old_genres)
+INSERT
+INTO movie_revisions (movie_id, version, operation, snapshot, diff)
+SELECT id,
+       version,
+       'update',
+       json_build_object('title', title, 'year', year, 'runtime', runtime || ' mins', 'genres', genres),
+       json_build_object('genres', json_build_object('from', old_genres, 'to', genres))
+FROM updated;
@@ -0,0 +1,4 @@
+-- The stored poster and backdrop images of a movie, empty when there is none. The value
+-- identifies the upload, so it changes whenever an image is replaced.
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS poster TEXT NOT NULL DEFAULT '';
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS backdrop TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,12 @@
+-- Alternate titles of a movie, one per locale. Locales are lower-cased BCP 47 language
+-- tags, such as "fr" or "pt-br".
+CREATE TABLE IF NOT EXISTS movie_titles
+(
+    movie_id   BIGINT                      NOT NULL REFERENCES movies (id) ON DELETE CASCADE,
+    locale     TEXT                        NOT NULL,
+    title      TEXT                        NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (movie_id, locale)
+);
+
+CREATE INDEX IF NOT EXISTS movie_titles_title_idx ON movie_titles USING GIN (to_tsvector('simple', title));
@@ -0,0 +1,18 @@
+-- Idempotency keys of POST requests, with the response to replay when a request is
+-- retried. Keys are scoped to a user (0 for anonymous requests) and a route. The status
+-- is NULL while the first request is still being processed.
+CREATE TABLE IF NOT EXISTS idempotency_keys
+(
+    user_id     BIGINT                      NOT NULL,
+    method      TEXT                        NOT NULL,
+    path        TEXT                        NOT NULL,
+    key         TEXT                        NOT NULL,
+    fingerprint BYTEA                       NOT NULL, -- SHA-256 hash of the query string and body
+    status      INTEGER,
+    headers     JSONB,
+    body        BYTEA,
+    created_at  TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, method, path, key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_created_at_idx ON idempotency_keys (created_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS movies_normalized_title_idx;
+DROP TABLE IF EXISTS movie_redirects;
@@ -0,0 +1,14 @@
+-- Movies merged into another keep redirecting their old id to the movie they were merged
+-- into.
+CREATE TABLE IF NOT EXISTS movie_redirects
+(
+    old_id     BIGINT PRIMARY KEY,
+    movie_id   BIGINT                      NOT NULL REFERENCES movies (id) ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS movie_redirects_movie_idx ON movie_redirects (movie_id);
+
+-- Duplicate detection looks movies up by year and title, ignoring case, spaces and
+-- punctuation.
+CREATE INDEX IF NOT EXISTS movies_normalized_title_idx ON movies (year, lower(regexp_replace(title, '[^[:alnum:]]+', '', 'g')));
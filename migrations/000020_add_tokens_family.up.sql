@@ -0,0 +1,6 @@
+-- Refresh tokens are rotated on every use. The tokens issued from one sign-in share a
+-- family, and a used token is kept until it expires so that replaying it can be detected.
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS family bytea;
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS used_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS tokens_family_idx ON tokens (family);
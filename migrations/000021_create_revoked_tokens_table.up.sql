@@ -0,0 +1,13 @@
+-- Access JWTs revoked before they expire, e.g. on logout, identified by their jti claim.
+-- A row is only needed until the token expires.
+CREATE TABLE IF NOT EXISTS revoked_tokens
+(
+    jti     TEXT PRIMARY KEY,
+    user_id BIGINT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expiry  TIMESTAMP(0) WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS revoked_tokens_expiry_idx ON revoked_tokens (expiry);
+
+-- Access JWTs issued before this time are revoked, e.g. by a password change.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_valid_after TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT to_timestamp(0);
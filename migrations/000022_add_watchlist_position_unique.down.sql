@@ -0,0 +1 @@
+ALTER TABLE watchlist_items DROP CONSTRAINT IF EXISTS watchlist_items_position_key;
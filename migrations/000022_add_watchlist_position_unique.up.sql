@@ -0,0 +1,12 @@
+-- Renumber positions which concurrent adds gave twice, then keep them unique per user. The
+-- constraint is checked at commit, as moving an item shifts the others one by one.
+UPDATE watchlist_items
+SET position = numbered.position
+FROM (SELECT user_id, movie_id, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY position, added_at, movie_id) AS position
+      FROM watchlist_items) AS numbered
+WHERE watchlist_items.user_id = numbered.user_id
+  AND watchlist_items.movie_id = numbered.movie_id
+  AND watchlist_items.position <> numbered.position;
+
+ALTER TABLE watchlist_items
+    ADD CONSTRAINT watchlist_items_position_key UNIQUE (user_id, position) DEFERRABLE INITIALLY DEFERRED;